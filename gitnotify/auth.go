@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/markbates/goth"
@@ -18,24 +19,59 @@ import (
 
 // Authentication data/$provider/$user/$settingsFile
 type Authentication struct {
-	Provider string `yaml:"provider"` // github/gitlab
-	Name     string `yaml:"name"`     // name of the person addressing to
-	Email    string `yaml:"email"`    // email that we will send to
-	UserName string `yaml:"username"` // username for identification
-	Token    string `yaml:"token"`    // used to query the provider
+	Provider string   `yaml:"provider"`         // github/gitlab/gitea/bitbucket
+	Name     string   `yaml:"name"`             // name of the person addressing to
+	Email    string   `yaml:"email"`            // email that we will send to
+	UserName string   `yaml:"username"`         // username for identification
+	Token    string   `yaml:"token"`            // used to query the provider
+	Scopes   []string `yaml:"scopes,omitempty"` // granted to the token, only github reports them
+	// gitea and bitbucket tokens expire and are refreshed with the refresh token
+	RefreshToken string    `yaml:"refresh_token,omitempty"`
+	Expiry       time.Time `yaml:"expiry,omitempty"`
 }
 
+// users opt in to private repositories through a separate login asking for the additional scope
+const (
+	privateAccess      = "private"
+	githubPrivateScope = "repo"
+)
+
 // UserInfo provides provider/username
 func (userInfo *Authentication) UserInfo() string {
 	return fmt.Sprintf("%s/%s", userInfo.Provider, userInfo.UserName)
 }
 
+// canReadPrivateRepos is true for providers without scopes since the token has full access
+func (userInfo *Authentication) canReadPrivateRepos() bool {
+	if userInfo.Provider != GithubProvider {
+		return true
+	}
+	return contains(userInfo.Scopes, githubPrivateScope)
+}
+
+// privateAccessURL is the login that grants access to private repositories. Empty when access is already granted
+func (userInfo *Authentication) privateAccessURL() string {
+	if userInfo.canReadPrivateRepos() {
+		return ""
+	}
+	return fmt.Sprintf("/auth/%s/%s", userInfo.Provider, privateAccess)
+}
+
 func (userInfo *Authentication) save() {
 	conf := new(Setting)
 	os.MkdirAll(userInfo.getConfigDir(), 0700)
+	unlock := lockSetting(userInfo.getConfigFile())
 	conf.load(userInfo.getConfigFile())
 	conf.Auth = userInfo
+	forgetTokenSource(userInfo)
+	reauthed := conf.ReauthRequired
+	conf.ReauthRequired = false
 	conf.save(userInfo.getConfigFile())
+	unlock()
+	if reauthed {
+		// cron was stopped when the old token was rejected
+		upsertCronEntry(conf)
+	}
 }
 
 func (userInfo *Authentication) getConfigDir() string {
@@ -59,17 +95,27 @@ func preInitAuth() {
 	var providers []goth.Provider
 
 	if provider := configureGithub(); provider != nil {
-		providers = append(providers, provider)
+		providers = append(providers, provider, configureGithubPrivateAccess())
 	}
 
 	if provider := configureGitlab(); provider != nil {
 		providers = append(providers, provider)
 	}
 
+	if provider := configureGitea(); provider != nil {
+		providers = append(providers, provider)
+	}
+
+	if provider := configureBitbucket(); provider != nil {
+		providers = append(providers, provider)
+	}
+
 	goth.UseProviders(providers...)
 }
 
 func initAuth(p *mux.Router) {
+	p.HandleFunc("/{provider}/callback/{access:private}", authProviderCallbackHandler).Methods("GET")
+	p.HandleFunc("/{provider}/{access:private}", authPrivateAccessHandler).Methods("GET")
 	p.HandleFunc("/{provider}/callback", authProviderCallbackHandler).Methods("GET")
 	p.HandleFunc("/{provider}", authProviderHandler).Methods("GET")
 	p.HandleFunc("/", authListHandler).Methods("GET")
@@ -86,12 +132,20 @@ func configureGithub() goth.Provider {
 		github.ProfileURL = config.GithubAPIEndPoint + "user"
 
 		config.Providers[GithubProvider] = "Github"
-		// for github, add scope: "repo:status" to access private repositories
+		// private repositories need the "repo" scope which users grant through configureGithubPrivateAccess
 		return github.New(os.Getenv("GITHUB_KEY"), os.Getenv("GITHUB_SECRET"), config.websiteURL()+"/auth/github/callback", "user:email")
 	}
 	return nil
 }
 
+// configureGithubPrivateAccess is not listed in the providers to login with. It is used from /auth/github/private
+// The callback is under the registered callback url since github only allows those
+func configureGithubPrivateAccess() goth.Provider {
+	provider := github.New(os.Getenv("GITHUB_KEY"), os.Getenv("GITHUB_SECRET"), config.websiteURL()+"/auth/github/callback/"+privateAccess, "user:email", githubPrivateScope)
+	provider.SetName(GithubProvider + "-" + privateAccess)
+	return provider
+}
+
 func configureGitlab() goth.Provider {
 	if config.GitlabURLEndPoint != "" && config.GitlabAPIEndPoint != "" {
 		if os.Getenv("GITLAB_KEY") == "" || os.Getenv("GITLAB_SECRET") == "" {
@@ -110,6 +164,35 @@ func configureGitlab() goth.Provider {
 
 }
 
+func configureGitea() goth.Provider {
+	if config.GiteaURLEndPoint != "" && config.GiteaAPIEndPoint != "" {
+		if os.Getenv("GITEA_KEY") == "" || os.Getenv("GITEA_SECRET") == "" {
+			panic("Missing Configuration: Gitea Authentication is not set!")
+		}
+
+		config.Providers[GiteaProvider] = "Gitea"
+		// gitea does not have scopes for OAuth2 applications, tokens get full access to the user's account
+		return newOAuthProvider(GiteaProvider, os.Getenv("GITEA_KEY"), os.Getenv("GITEA_SECRET"), config.websiteURL()+"/auth/gitea/callback",
+			config.GiteaURLEndPoint+"login/oauth/authorize", config.GiteaURLEndPoint+"login/oauth/access_token", fetchGiteaUser)
+	}
+	return nil
+}
+
+// Bitbucket Server supports OAuth2 incoming application links from version 7.21
+func configureBitbucket() goth.Provider {
+	if config.BitbucketURLEndPoint != "" && config.BitbucketAPIEndPoint != "" {
+		if os.Getenv("BITBUCKET_KEY") == "" || os.Getenv("BITBUCKET_SECRET") == "" {
+			panic("Missing Configuration: Bitbucket Authentication is not set!")
+		}
+
+		config.Providers[BitbucketProvider] = "Bitbucket"
+		// REPO_READ gives read access to all repositories the user can see
+		return newOAuthProvider(BitbucketProvider, os.Getenv("BITBUCKET_KEY"), os.Getenv("BITBUCKET_SECRET"), config.websiteURL()+"/auth/bitbucket/callback",
+			config.BitbucketURLEndPoint+"rest/oauth2/latest/authorize", config.BitbucketURLEndPoint+"rest/oauth2/latest/token", fetchBitbucketUser, "REPO_READ")
+	}
+	return nil
+}
+
 func authListHandler(res http.ResponseWriter, req *http.Request) {
 	var keys []string
 	for k := range config.Providers {
@@ -133,6 +216,20 @@ func authProviderHandler(res http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func authPrivateAccessHandler(res http.ResponseWriter, req *http.Request) {
+	hc := &kinli.HttpContext{W: res, R: req}
+	if hc.RedirectUnlessAuthed("Kindly Login before granting access to private repositories") {
+		return
+	}
+	provider, _ := getProviderName(req)
+	if _, err := goth.GetProvider(provider); err != nil {
+		kinli.DisplayText(hc, res, "Access to private repositories does not need to be granted separately for "+mux.Vars(req)["provider"])
+		return
+	}
+	statCount("auth.private_access")
+	gothic.BeginAuthHandler(res, req)
+}
+
 func authProviderCallbackHandler(res http.ResponseWriter, req *http.Request) {
 	statCount("auth.complete")
 	user, err := gothic.CompleteUserAuth(res, req)
@@ -140,13 +237,17 @@ func authProviderCallbackHandler(res http.ResponseWriter, req *http.Request) {
 		fmt.Fprintln(res, err)
 		return
 	}
-	authType, _ := getProviderName(req)
+	authType := mux.Vars(req)["provider"]
 	auth := &Authentication{
 		Provider: authType,
 		UserName: user.NickName,
 		Name:     user.Name,
 		Email:    user.Email,
 		Token:    user.AccessToken,
+		Scopes:   grantedScopes(authType, user.AccessToken),
+
+		RefreshToken: user.RefreshToken,
+		Expiry:       user.ExpiresAt,
 	}
 	auth.save()
 
@@ -162,13 +263,16 @@ type ProviderIndex struct {
 }
 
 // See gothic/gothic.go: GetProviderName function
-// Overridden since we use mux
+// Overridden since we use mux. Granting private access is a separate provider, see configureGithubPrivateAccess
 func getProviderName(req *http.Request) (string, error) {
 	vars := mux.Vars(req)
 	provider := vars["provider"]
 	if provider == "" {
 		return provider, errors.New("you must select a provider")
 	}
+	if vars["access"] != "" {
+		provider += "-" + vars["access"]
+	}
 	return provider, nil
 }
 
@@ -0,0 +1,355 @@
+package gitnotify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/markbates/goth"
+	"golang.org/x/oauth2"
+)
+
+/*
+Bitbucket Server / Data Center. Repositories are tracked as PROJECT/repo-slug
+and projects take the place of organisations. Example:
+  {
+    "values": [{
+      "id": "refs/heads/master",
+      "displayId": "master",
+      "latestCommit": "c36c69c0613a359a41fe5da8e70047bffe7f97c2"
+    }],
+    "isLastPage": false,
+    "nextPageStart": 25
+  }
+*/
+
+const bitbucketPageSize = 100
+
+type localBitbucket struct {
+	client GitClient
+}
+
+// splits PROJECT/repo into project and repo slug
+func bitbucketProjectRepo(repo string) (string, string) {
+	projectRepo := strings.SplitN(repo, "/", 2)
+	if len(projectRepo) != 2 {
+		return repo, ""
+	}
+	return projectRepo[0], projectRepo[1]
+}
+
+// Helpers
+
+func (*localBitbucket) WebsiteLink() string {
+	return config.BitbucketURLEndPoint
+}
+
+// RepoLink links to the project when repo does not contain the slug
+func (*localBitbucket) RepoLink(repo string) string {
+	project, slug := bitbucketProjectRepo(repo)
+	if slug == "" {
+		return fmt.Sprintf(bitbucketProjectEndPoint, project)
+	}
+	return fmt.Sprintf(bitbucketRepoEndPoint, project, slug)
+}
+
+func (*localBitbucket) TreeLink(repo, ref string) string {
+	project, slug := bitbucketProjectRepo(repo)
+	return fmt.Sprintf(bitbucketTreeURLEndPoint, project, slug, url.QueryEscape(ref))
+}
+
+func (*localBitbucket) CommitLink(repo, ref string) string {
+	project, slug := bitbucketProjectRepo(repo)
+	return fmt.Sprintf(bitbucketCommitURLEndPoint, project, slug, url.QueryEscape(ref))
+}
+
+func (*localBitbucket) CompareLink(repo, oldCommit, newCommit string) string {
+	project, slug := bitbucketProjectRepo(repo)
+	return fmt.Sprintf(bitbucketCompareURLEndPoint, project, slug, url.QueryEscape(oldCommit), url.QueryEscape(newCommit))
+}
+
+func (g *localBitbucket) Client() *http.Client {
+	return g.client.(*http.Client)
+}
+
+func newBitbucketClient(token string) *localBitbucket {
+	if token == "" {
+		return &localBitbucket{}
+	}
+	return newBitbucketClientFor(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+}
+
+func newBitbucketClientFor(ts oauth2.TokenSource) *localBitbucket {
+	return &localBitbucket{newAPIClient(ts, nil)}
+}
+
+// get requests path relative to bitbucketAPIEndPoint and decodes the json response into v
+func (g *localBitbucket) get(path string, query url.Values, v interface{}) error {
+	u := config.BitbucketAPIEndPoint + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return getJSON(g.Client(), BitbucketProvider, u, v)
+}
+
+type bitbucketPage struct {
+	IsLastPage    bool `json:"isLastPage"`
+	NextPageStart int  `json:"nextPageStart"`
+}
+
+// paginate follows nextPageStart until isLastPage is set. fetch decodes the page and returns its paging info
+func (g *localBitbucket) paginate(path string, query url.Values, fetch func(pagePath string) (*bitbucketPage, error)) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("limit", fmt.Sprintf("%d", bitbucketPageSize))
+	start := 0
+	for i := 0; i < 100; i++ {
+		query.Set("start", fmt.Sprintf("%d", start))
+		page, err := fetch(path + "?" + query.Encode())
+		if err != nil {
+			return err
+		}
+		if page.IsLastPage || page.NextPageStart <= start {
+			break
+		}
+		start = page.NextPageStart
+	}
+	return nil
+}
+
+func (g *localBitbucket) repoPath(repoName string) string {
+	project, slug := bitbucketProjectRepo(repoName)
+	return "projects/" + url.PathEscape(project) + "/repos/" + url.PathEscape(slug)
+}
+
+type bitbucketRef struct {
+	ID           string `json:"id"`
+	DisplayID    string `json:"displayId"`
+	LatestCommit string `json:"latestCommit"`
+}
+
+type bitbucketRepo struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Public      bool   `json:"public"`
+	Project     struct {
+		Key string `json:"key"`
+	} `json:"project"`
+}
+
+type bitbucketProject struct {
+	ID          int64  `json:"id"`
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type bitbucketUser struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+// fetchBitbucketUser is used at the time of login to fill in the user's profile
+// Bitbucket server does not have a "current user" api, the username is found through whoami
+func fetchBitbucketUser(token string, user *goth.User) error {
+	client := newBitbucketClient(token)
+	resp, err := client.Client().Get(config.BitbucketURLEndPoint + "plugins/servlet/applinks/whoami")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	name, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode >= 400 || len(name) == 0 {
+		return fmt.Errorf("%s could not identify the logged in user", BitbucketProvider)
+	}
+
+	u := &bitbucketUser{}
+	if err := client.get("users/"+url.PathEscape(strings.TrimSpace(string(name))), nil, u); err != nil {
+		return err
+	}
+
+	user.UserID = fmt.Sprintf("%d", u.ID)
+	user.NickName = u.Slug
+	user.Name = u.DisplayName
+	user.Email = u.EmailAddress
+	return nil
+}
+
+func (g *localBitbucket) refs(repoName, refType string) ([]*GitRefWithCommit, error) {
+	refs := make([]*GitRefWithCommit, 0, bitbucketPageSize)
+	err := g.paginate(g.repoPath(repoName)+"/"+refType, nil, func(pagePath string) (*bitbucketPage, error) {
+		list := &struct {
+			bitbucketPage
+			Values []*bitbucketRef `json:"values"`
+		}{}
+		if err := g.get(pagePath, nil, list); err != nil {
+			return nil, err
+		}
+		for _, r := range list.Values {
+			refs = append(refs, &GitRefWithCommit{Name: r.DisplayID, Commit: r.LatestCommit})
+		}
+		return &list.bitbucketPage, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (g *localBitbucket) Branches(repoName string) ([]*GitRefWithCommit, error) {
+	statCount("bitbucket.branches")
+	return g.refs(repoName, "branches")
+}
+
+func (g *localBitbucket) BranchesWithoutRefs(repoName string) ([]string, error) {
+	statCount("bitbucket.branches_without_refs")
+	listBranches, err := g.Branches(repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	branches := make([]string, 0, len(listBranches))
+	for _, b := range listBranches {
+		branches = append(branches, b.Name)
+	}
+	return branches, nil
+}
+
+func (g *localBitbucket) Tags(repoName string) ([]*GitRefWithCommit, error) {
+	statCount("bitbucket.tags")
+	return g.refs(repoName, "tags")
+}
+
+// DefaultBranch uses the deprecated endpoint for servers older than 7.5
+func (g *localBitbucket) DefaultBranch(repoName string) (string, error) {
+	statCount("bitbucket.default_branch")
+	ref := &bitbucketRef{}
+	err := g.get(g.repoPath(repoName)+"/default-branch", nil, ref)
+	if isNotFound(err) {
+		err = g.get(g.repoPath(repoName)+"/branches/default", nil, ref)
+	}
+	if err != nil {
+		return "", err
+	}
+	return ref.DisplayID, nil
+}
+
+// SearchRepos matches the repository name. PROJECT/name restricts the search to the project
+func (g *localBitbucket) SearchRepos(query string) ([]*searchRepoItem, error) {
+	statCount("bitbucket.search_repos")
+	q := url.Values{"limit": {"25"}}
+	project, name := bitbucketProjectRepo(strings.TrimSpace(query))
+	if name == "" {
+		q.Set("name", project)
+	} else {
+		q.Set("name", name)
+	}
+
+	result := &struct {
+		Values []*bitbucketRepo `json:"values"`
+	}{}
+	if err := g.get("repos", q, result); err != nil {
+		return nil, err
+	}
+
+	searchResults := make([]*searchRepoItem, 0, len(result.Values))
+	for _, r := range result.Values {
+		if name != "" && !strings.EqualFold(r.Project.Key, project) {
+			continue
+		}
+		searchResults = append(searchResults, &searchRepoItem{
+			ID:          r.Slug,
+			Name:        r.Project.Key + "/" + r.Slug,
+			Description: r.Description,
+		})
+	}
+	return searchResults, nil
+}
+
+// SearchUsers searches projects since they take the place of organisations
+func (g *localBitbucket) SearchUsers(query string) ([]*searchUserItem, error) {
+	statCount("bitbucket.search_users")
+	result := &struct {
+		Values []*bitbucketProject `json:"values"`
+	}{}
+	if err := g.get("projects", url.Values{"name": {query}}, result); err != nil {
+		return []*searchUserItem{}, err
+	}
+
+	searchResults := make([]*searchUserItem, 0, len(result.Values))
+	for _, p := range result.Values {
+		searchResults = append(searchResults, &searchUserItem{
+			ID:    fmt.Sprintf("%d", p.ID),
+			Login: p.Key,
+			Type:  "Project",
+		})
+	}
+	return searchResults, nil
+}
+
+// RemoteOrgType returns Project for projects and User for a user's personal project
+func (g *localBitbucket) RemoteOrgType(name string) (string, error) {
+	statCount("bitbucket.remote_org_type")
+	project := &bitbucketProject{}
+	err := g.get("projects/"+url.PathEscape(name), nil, project)
+	if err == nil {
+		return "Project", nil
+	}
+	if !isNotFound(err) {
+		return "", err
+	}
+
+	user := &bitbucketUser{}
+	if err := g.get("users/"+url.PathEscape(name), nil, user); err != nil {
+		return "", err
+	}
+	return "User", nil
+}
+
+// ReposForUser lists the repositories of a project. Users are looked up via their personal project ~user
+// and their repositories are linked under it
+func (g *localBitbucket) ReposForUser(project string) ([]*searchRepoItem, error) {
+	statCount("bitbucket.repos_for_user")
+	orgType, err := g.RemoteOrgType(project)
+	if err != nil {
+		return nil, err
+	}
+	if orgType == "User" {
+		project = "~" + project
+	}
+
+	var repoList []*searchRepoItem
+	err = g.paginate("projects/"+url.PathEscape(project)+"/repos", nil, func(pagePath string) (*bitbucketPage, error) {
+		list := &struct {
+			bitbucketPage
+			Values []*bitbucketRepo `json:"values"`
+		}{}
+		if err := g.get(pagePath, nil, list); err != nil {
+			return nil, err
+		}
+		for _, r := range list.Values {
+			item := &searchRepoItem{
+				ID:          r.Slug,
+				Name:        r.Slug,
+				Description: r.Description,
+				Private:     !r.Public,
+			}
+			if orgType == "User" {
+				item.Path = project + "/" + r.Slug
+			}
+			repoList = append(repoList, item)
+		}
+		return &list.bitbucketPage, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repoList, nil
+}
@@ -0,0 +1,109 @@
+package gitnotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// newFakeBitbucket serves branchCount branches of ACME/widgets the same way bitbucket server pages them.
+// The default branch is served only through the endpoint of servers older than 7.5
+func newFakeBitbucket(t *testing.T, branchCount int) {
+	repos := func(slugs ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var values []*bitbucketRepo
+			for _, slug := range slugs {
+				values = append(values, &bitbucketRepo{Slug: slug})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"values": values, "isLastPage": true})
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/1.0/projects/ACME/repos/widgets/branches", func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		var values []*bitbucketRef
+		for i := start; i < start+limit && i < branchCount; i++ {
+			values = append(values, &bitbucketRef{DisplayID: fmt.Sprintf("branch-%03d", i), LatestCommit: fmt.Sprintf("%040d", i)})
+		}
+		page := map[string]interface{}{"values": values, "isLastPage": start+limit >= branchCount}
+		if start+limit < branchCount {
+			page["nextPageStart"] = start + limit
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+	mux.HandleFunc("/rest/api/1.0/projects/ACME/repos/widgets/branches/default", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&bitbucketRef{ID: "refs/heads/develop", DisplayID: "develop"})
+	})
+	mux.HandleFunc("/rest/api/1.0/projects/ACME", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&bitbucketProject{ID: 1, Key: "ACME"})
+	})
+	mux.HandleFunc("/rest/api/1.0/users/jdoe", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&bitbucketUser{ID: 2, Slug: "jdoe"})
+	})
+	mux.HandleFunc("/rest/api/1.0/projects/ACME/repos", repos("widgets", "gadgets"))
+	mux.HandleFunc("/rest/api/1.0/projects/~jdoe/repos", repos("dotfiles"))
+	newFakeServer(t, &config.BitbucketAPIEndPoint, "/rest/api/1.0/", mux)
+}
+
+func TestBitbucketBranchesPaginate(t *testing.T) {
+	newFakeBitbucket(t, 2*bitbucketPageSize+10)
+
+	refs, err := newBitbucketClient("token").Branches("ACME/widgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 2*bitbucketPageSize+10 {
+		t.Fatalf("expected every page to be fetched, got %d branches", len(refs))
+	}
+	last := refs[len(refs)-1]
+	if last.Name != fmt.Sprintf("branch-%03d", len(refs)-1) || last.Commit != fmt.Sprintf("%040d", len(refs)-1) {
+		t.Errorf("unexpected last ref %v", last)
+	}
+}
+
+func TestBitbucketDefaultBranchFallback(t *testing.T) {
+	newFakeBitbucket(t, 0)
+
+	branch, err := newBitbucketClient("token").DefaultBranch("ACME/widgets")
+	if err != nil || branch != "develop" {
+		t.Errorf("expected the default branch from the deprecated endpoint, got %q %v", branch, err)
+	}
+	if _, err := newBitbucketClient("token").DefaultBranch("ACME/missing"); !isNotFound(err) {
+		t.Errorf("expected a missing repository to be not found, got %v", err)
+	}
+}
+
+func TestBitbucketProjectsAndUsers(t *testing.T) {
+	newFakeBitbucket(t, 0)
+	client := newBitbucketClient("token")
+
+	if orgType, err := client.RemoteOrgType("ACME"); err != nil || orgType != "Project" {
+		t.Errorf("expected ACME to be a Project, got %q %v", orgType, err)
+	}
+	if orgType, err := client.RemoteOrgType("jdoe"); err != nil || orgType != "User" {
+		t.Errorf("expected jdoe to be a User, got %q %v", orgType, err)
+	}
+	if _, err := client.RemoteOrgType("nobody"); err == nil {
+		t.Error("expected an error for a name that is neither a project nor a user")
+	}
+
+	repos, err := client.ReposForUser("ACME")
+	if err != nil || len(repos) != 2 || repos[0].Name != "widgets" {
+		t.Errorf("expected the repositories of the project, got %v %v", repos, err)
+	}
+	repos, err = client.ReposForUser("jdoe")
+	if err != nil || len(repos) != 1 || repos[0].Name != "dotfiles" {
+		t.Fatalf("expected the repositories of the personal project ~jdoe, got %v %v", repos, err)
+	}
+	defer func(endPoint string) { bitbucketRepoEndPoint = endPoint }(bitbucketRepoEndPoint)
+	bitbucketRepoEndPoint = "https://bitbucket.acme.com/projects/%s/repos/%s/browse"
+	conf := &Setting{Auth: &Authentication{Provider: BitbucketProvider, UserName: "jdoe"}}
+	org := &Organisation{Name: "jdoe", Type: "User", Provider: BitbucketProvider}
+	diff := makeDiffForOrg(conf, org, []string{"dotfiles"}, repos, true)
+	if href := diff.Data[0].Changes[0].Href; href != "https://bitbucket.acme.com/projects/~jdoe/repos/dotfiles/browse" {
+		t.Errorf("expected personal repositories to be linked under ~jdoe, got %s", href)
+	}
+}
@@ -0,0 +1,61 @@
+package gitnotify
+
+import "strings"
+
+// Branch patterns are globs on branch names like release/* or hotfix-*. * does not match across a /, ** does.
+// Named references with a pattern track every branch matching it, including branches created later
+
+func isBranchPattern(name string) bool {
+	return strings.ContainsAny(name, "*?")
+}
+
+// trackedBranches expands the patterns of the named references with the branches of the repository
+func (r *Repo) trackedBranches(branches []*GitRefWithCommit) []string {
+	var names []string
+	for _, ref := range r.NamedReferences {
+		s := string(ref)
+		if !isBranchPattern(s) {
+			if !contains(names, s) {
+				names = append(names, s)
+			}
+			continue
+		}
+		pattern := globPattern(s)
+		for _, b := range branches {
+			if pattern.MatchString(b.Name) && !contains(names, b.Name) {
+				names = append(names, b.Name)
+			}
+		}
+	}
+	return names
+}
+
+// matchesBranchPattern is true when a pattern of the named references matches the branch
+func (r *Repo) matchesBranchPattern(name string) bool {
+	for _, ref := range r.NamedReferences {
+		if s := string(ref); isBranchPattern(s) && globPattern(s).MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportsDeletedBranch is true when the deleted branches list the branch. stored are the branches of the last run
+func (r *Repo) reportsDeletedBranch(name string, stored []string) bool {
+	return r.Branches && r.DeletedRefs && contains(stored, name) && len(filterBranches(r, []string{name})) > 0
+}
+
+// filterBranches returns the new branches matching the branch patterns of the repository.
+// Every branch matches when there are no patterns
+func filterBranches(repo *Repo, branches []string) []string {
+	if len(repo.BranchPatterns) == 0 {
+		return branches
+	}
+	var matched []string
+	for _, b := range branches {
+		if matchesAnyGlob(repo.BranchPatterns, b) {
+			matched = append(matched, b)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,130 @@
+package gitnotify
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProcessRepoDiffBranchPatterns(t *testing.T) {
+	repo := &Repo{
+		Repo:            "acme/widgets",
+		NamedReferences: []reference{"master", "release/*"},
+		Branches:        true,
+		BranchPatterns:  parsePathGlobs([]string{"release/*, hotfix-*"}),
+	}
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		branches:     refs("master", "develop", "release/1.0", "release/1.0/docs", "hotfix-42", "pr-1234"),
+	}
+	info := storedInfo()
+
+	diff, err := processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(diff.RefList[0].References, []string{"hotfix-42", "release/1.0"}) {
+		t.Errorf("expected only matching new branches to be reported, got %v", diff.RefList[0].References)
+	}
+	if len(diff.References) != 2 || diff.References["release/1.0"] == nil {
+		t.Fatalf("expected release/1.0 to be tracked, got %v", diff.References)
+	}
+	if c := diff.References["release/1.0"]; c.OldCommit != "" || c.NewCommit != "release/1.0-commit" {
+		t.Errorf("expected release/1.0 to be tracked from its latest commit, got %v", c)
+	}
+	if info["acme/widgets"].Repo.Commits["release/1.0"] != "release/1.0-commit" {
+		t.Errorf("expected the commit of release/1.0 to be stored, got %v", info["acme/widgets"].Repo.Commits)
+	}
+}
+
+func TestProcessRepoDiffDeletedPatternBranch(t *testing.T) {
+	repo := &Repo{
+		Repo:            "acme/widgets",
+		Provider:        GithubProvider,
+		NamedReferences: []reference{"master", "release/*"},
+	}
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		branches:     refs("master", "release/1.0"),
+	}
+	info := storedInfo()
+	info["acme/widgets"].Repo.Commits["feature"] = "feature-commit"
+	if _, err := processRepoDiff(remote, repo, info); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := info["acme/widgets"].Repo.Commits["feature"]; ok {
+		t.Errorf("expected the untracked branch to be removed, got %v", info["acme/widgets"].Repo.Commits)
+	}
+
+	remote.branches = refs("master")
+	conf := &Setting{Auth: &Authentication{Provider: GithubProvider}}
+	var reported []diffData
+	for run := 0; run < 2; run++ {
+		diff, err := processRepoDiff(remote, repo, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range makeRepoDiffs([]*gitRepoDiffs{diff}, conf) {
+			for _, data := range d.Data {
+				if data.ChangeType == "repoBranchDiff" && data.Changed {
+					reported = append(reported, data)
+				}
+			}
+		}
+		for name, commit := range info["acme/widgets"].Repo.Commits {
+			if commit == "" || commit == noneString {
+				t.Errorf("expected no empty commit to be stored for %s", name)
+			}
+		}
+	}
+	if len(reported) != 1 || reported[0].Title.Text != "release/1.0" {
+		t.Fatalf("expected the deleted branch to be reported once, got %+v", reported)
+	}
+	if reported[0].Title.Href != CommitLink(GithubProvider, "acme/widgets", "release/1.0-commit") || reported[0].Error == "" {
+		t.Errorf("expected a link to the last commit of the deleted branch, got %+v", reported[0])
+	}
+}
+
+func TestProcessRepoDiffDeletedPatternBranchReportedOnce(t *testing.T) {
+	repo := &Repo{
+		Repo:            "acme/widgets",
+		Provider:        GithubProvider,
+		NamedReferences: []reference{"release/*"},
+		Branches:        true,
+		DeletedRefs:     true,
+	}
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		branches:     refs("master", "release/1.0"),
+	}
+	info := storedInfo()
+	if _, err := processRepoDiff(remote, repo, info); err != nil {
+		t.Fatal(err)
+	}
+
+	remote.branches = refs("master")
+	diff, err := processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &Setting{Auth: &Authentication{Provider: GithubProvider}}
+	var reported []string
+	for _, data := range makeRepoDiffs([]*gitRepoDiffs{diff}, conf)[0].Data {
+		if !data.Changed {
+			continue
+		}
+		if data.ChangeType == "repoBranchDiff" {
+			reported = append(reported, data.ChangeType+" "+data.Title.Text)
+		}
+		if data.ChangeType == "repoRefDeleted" {
+			for _, change := range data.Changes {
+				reported = append(reported, data.ChangeType+" "+change.Text)
+			}
+		}
+	}
+	if len(reported) != 1 || reported[0] != "repoRefDeleted release/1.0" {
+		t.Errorf("expected the deleted branch only in the deleted branches, got %v", reported)
+	}
+	if _, ok := info["acme/widgets"].Repo.Commits["release/1.0"]; ok {
+		t.Errorf("expected the deleted branch to be no longer tracked")
+	}
+}
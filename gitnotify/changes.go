@@ -25,6 +25,7 @@ type gnDiffData struct {
 	Changed bool       `json:"changed"`
 	Data    []diffData `json:"data"`
 	MadeFor string     `json:"made_for"`
+	Private bool       `json:"private"` // not sent to webhooks unless the user allows it
 }
 
 type diffData struct {
@@ -33,6 +34,21 @@ type diffData struct {
 	ChangeType string `json:"change_type"`
 	Changed    bool   `json:"changed"`
 	Changes    []link `json:"changes"`
+	// Release is set for repoReleaseDiff
+	Release *releaseNote `json:"release,omitempty"`
+	// Commits are the latest commits of a repoBranchDiff. MoreCommits is the number of commits left out
+	Commits     []commitLine `json:"commits,omitempty"`
+	MoreCommits int          `json:"more_commits,omitempty"`
+	Stat        *diffStat    `json:"stat,omitempty"`
+	// MatchedFiles are the changed files matching the path filters of the repository
+	MatchedFiles []string `json:"matched_files,omitempty"`
+	// ForcePushed is set when the old commit of a repoBranchDiff is no longer part of the branch
+	ForcePushed    bool `json:"force_pushed,omitempty"`
+	DroppedCommits int  `json:"dropped_commits,omitempty"`
+	// PullRequest is set for repoPullRequestDiff
+	PullRequest *pullRequestNote `json:"pull_request,omitempty"`
+	// Issues are set for repoIssueDiff
+	Issues []issueNote `json:"issues,omitempty"`
 }
 
 type link struct {
@@ -108,6 +124,17 @@ func (r *gnDiffDatum) hasChanges() bool {
 	return false
 }
 
+// withoutPrivate leaves out private repositories
+func (r *gnDiffDatum) withoutPrivate() gnDiffDatum {
+	var diffs gnDiffDatum
+	for _, a := range *r {
+		if !a.Private {
+			diffs = append(diffs, a)
+		}
+	}
+	return diffs
+}
+
 type changeDetail struct {
 	Display   string
 	Reference int64
@@ -0,0 +1,156 @@
+package gitnotify
+
+import (
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// number of directories with the most changes listed in the diffstat
+const topDirectoriesCount = 3
+
+// commitComparer is implemented by providers with an api to compare two commits
+type commitComparer interface {
+	Compare(repoName, oldCommit, newCommit string) (*gitComparison, error)
+}
+
+// gitComparison lists the commits reachable from the new commit but not from the old commit, oldest first
+type gitComparison struct {
+	Commits      []*GitCommit // the latest commits when the provider limits them
+	TotalCommits int          // providers return a limited number of commits
+	Files        []*GitFileChange
+	FilesLeftOut bool   // set when the provider may have left out some of the files
+	Status       string // ahead, behind, diverged or identical. empty when the provider does not tell
+	BehindBy     int    // commits of the old commit that are not reachable from the new commit
+}
+
+func (c *gitComparison) forcePushed() bool {
+	return c.Status == "behind" || c.Status == "diverged"
+}
+
+// GitFileChange is the number of lines changed in a file
+type GitFileChange struct {
+	Path         string
+	PreviousPath string // set for renamed files
+	Additions    int
+	Deletions    int
+}
+
+// GitCommit is a single commit of a comparison
+type GitCommit struct {
+	SHA     string
+	Author  string
+	Date    time.Time
+	Message string
+}
+
+// commitLine is a commit as shown in notifications
+type commitLine struct {
+	ShortSHA string    `json:"short_sha"`
+	Author   string    `json:"author"`
+	Date     time.Time `json:"date"`
+	Message  string    `json:"message"` // first line of the message
+	Href     string    `json:"href"`
+}
+
+// compareCommits attaches the commits between the old and new commit of changed references
+// A failed comparison leaves out the commits since the notification has the compare link
+func compareCommits(client GitRemoteIface, repo *Repo, references map[string]*gitCommitDiff) error {
+	comparer, ok := baseClient(client).(commitComparer)
+	if !ok {
+		return nil
+	}
+	for _, commit := range references {
+		if commit.OldCommit == "" || commit.NewCommit == noneString || !commit.changed() {
+			continue
+		}
+		comparison, err := comparer.Compare(repo.remoteName(), commit.OldCommit, commit.NewCommit)
+		if stopsRun(err) {
+			return err
+		}
+		if err != nil {
+			statCount("run.compare_failed")
+			log.Printf("Failed comparing %s..%s for %s: %s", commit.shortOldCommit(), commit.shortNewCommit(), repo.Repo, err)
+			continue
+		}
+		commit.Comparison = comparison
+	}
+	return nil
+}
+
+// diffStat summarises the size of a comparison
+type diffStat struct {
+	Commits        int       `json:"commits"`
+	FilesChanged   int       `json:"files_changed"`
+	Additions      int       `json:"additions"`
+	Deletions      int       `json:"deletions"`
+	TopDirectories []dirStat `json:"top_directories"`
+}
+
+// dirStat is the number of lines changed under a top level directory. Files in the root are under "/"
+type dirStat struct {
+	Path    string `json:"path"`
+	Changes int    `json:"changes"`
+}
+
+func comparisonStat(comparison *gitComparison) *diffStat {
+	if comparison == nil {
+		return nil
+	}
+	stat := &diffStat{Commits: comparison.TotalCommits, FilesChanged: len(comparison.Files)}
+	if stat.Commits < len(comparison.Commits) {
+		stat.Commits = len(comparison.Commits)
+	}
+
+	changes := make(map[string]int)
+	for _, f := range comparison.Files {
+		stat.Additions += f.Additions
+		stat.Deletions += f.Deletions
+		dir := "/"
+		if i := strings.Index(f.Path, "/"); i > 0 {
+			dir = path.Clean(f.Path[:i]) + "/"
+		}
+		changes[dir] += f.Additions + f.Deletions
+	}
+	for dir, n := range changes {
+		stat.TopDirectories = append(stat.TopDirectories, dirStat{dir, n})
+	}
+	sort.Slice(stat.TopDirectories, func(i, j int) bool {
+		a, b := stat.TopDirectories[i], stat.TopDirectories[j]
+		if a.Changes != b.Changes {
+			return a.Changes > b.Changes
+		}
+		return a.Path < b.Path
+	})
+	if len(stat.TopDirectories) > topDirectoriesCount {
+		stat.TopDirectories = stat.TopDirectories[:topDirectoriesCount]
+	}
+	return stat
+}
+
+// commitLines returns the latest commits first, limited to config.commitListLimit.
+// The number of commits left out is returned as well
+func commitLines(provider, repoName string, comparison *gitComparison) ([]commitLine, int) {
+	if comparison == nil {
+		return nil, 0
+	}
+	limit := config.commitListLimit()
+	var lines []commitLine
+	for i := len(comparison.Commits) - 1; i >= 0 && len(lines) < limit; i-- {
+		c := comparison.Commits[i]
+		lines = append(lines, commitLine{
+			ShortSHA: shortCommit(c.SHA),
+			Author:   c.Author,
+			Date:     c.Date,
+			Message:  strings.TrimSpace(strings.SplitN(c.Message, "\n", 2)[0]),
+			Href:     CommitLink(provider, repoName, c.SHA),
+		})
+	}
+	total := comparison.TotalCommits
+	if total < len(comparison.Commits) {
+		total = len(comparison.Commits)
+	}
+	return lines, total - len(lines)
+}
@@ -0,0 +1,102 @@
+package gitnotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestProcessRepoDiffCommitList(t *testing.T) {
+	restoreConfig(t)
+	config.CommitListLimit = 2
+
+	// providers limiting the commits return the latest ones
+	comparison := &gitComparison{TotalCommits: 300}
+	for i := 51; i <= 300; i++ {
+		comparison.Commits = append(comparison.Commits, &GitCommit{SHA: fmt.Sprintf("%040d", i), Author: "dev", Message: fmt.Sprintf("change %d\n\ndetails", i)})
+	}
+	repo := &Repo{Repo: "acme/widgets", NamedReferences: []reference{"master"}}
+	remote := &fakeRemote{localGitnull: &localGitnull{GithubProvider}, branches: refs("master"), comparison: comparison}
+
+	diff, err := processRepoDiff(&prefetchedClient{remote, &repoRefs{}}, repo, storedInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &Setting{Auth: &Authentication{Provider: GithubProvider}}
+	data := makeRepoDiffs([]*gitRepoDiffs{diff}, conf)[0].Data[0]
+	if len(data.Commits) != 2 || data.MoreCommits != 298 {
+		t.Fatalf("expected 2 commits and 298 more, got %d and %d", len(data.Commits), data.MoreCommits)
+	}
+	if data.Commits[0].Message != "change 300" || data.Commits[0].ShortSHA != shortCommit(comparison.Commits[249].SHA) {
+		t.Errorf("expected the latest commit first with the first line of the message, got %+v", data.Commits[0])
+	}
+}
+
+func TestComparisonStat(t *testing.T) {
+	additions, deletions := countDiffLines("@@ -1,3 +1,3 @@\n context\n-old\n+new\n+added\n")
+	comparison := &gitComparison{
+		Commits: []*GitCommit{{SHA: "a"}, {SHA: "b"}},
+		Files: []*GitFileChange{
+			{Path: "README.md", Additions: additions, Deletions: deletions},
+			{Path: "api/server.go", Additions: 10, Deletions: 5},
+			{Path: "api/routes.go", Additions: 1},
+			{Path: "web/app.js", Additions: 4},
+			{Path: "docs/index.md", Additions: 1},
+		},
+	}
+	stat := comparisonStat(comparison)
+	if stat.Commits != 2 || stat.FilesChanged != 5 || stat.Additions != 18 || stat.Deletions != 6 {
+		t.Errorf("unexpected stat %+v", stat)
+	}
+	expected := []dirStat{{"api/", 16}, {"web/", 4}, {"/", 3}}
+	if fmt.Sprint(stat.TopDirectories) != fmt.Sprint(expected) {
+		t.Errorf("expected top directories %v, got %v", expected, stat.TopDirectories)
+	}
+}
+
+func TestGithubCompareFetchesLatestCommits(t *testing.T) {
+	restoreConfig(t)
+	config.CommitListLimit = 2
+
+	commits := func(from, to int) []map[string]string {
+		var list []map[string]string
+		for i := from; i <= to; i++ {
+			list = append(list, map[string]string{"sha": fmt.Sprintf("%040d", i)})
+		}
+		return list
+	}
+	var pages []string
+	newFakeServer(t, &config.GithubAPIEndPoint, "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pages = append(pages, r.URL.Query().Get("page"))
+		list := commits(1, 250)
+		if page > 0 {
+			list = commits((page-1)*100+1, page*100)
+			if page == 4 {
+				list = commits(301, 301)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "ahead", "total_commits": 301, "commits": list})
+	}))
+
+	comparison, err := getGitClient(GithubProvider, "token").(commitComparer).Compare("acme/widgets", "old", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(pages) != "[ 4 3]" {
+		t.Errorf("expected the last pages to be fetched until the commit list is filled, got %v", pages)
+	}
+	lines, more := commitLines(GithubProvider, "acme/widgets", comparison)
+	if len(lines) != 2 || more != 299 || lines[0].Href != CommitLink(GithubProvider, "acme/widgets", fmt.Sprintf("%040d", 301)) || lines[1].Href != CommitLink(GithubProvider, "acme/widgets", fmt.Sprintf("%040d", 300)) {
+		t.Errorf("expected the latest commits first, got %+v and %d more", lines, more)
+	}
+}
+
+func TestCountDiffLines(t *testing.T) {
+	diff := "--- a/docs/index.md\n+++ b/docs/index.md\n@@ -1,3 +1,3 @@\n title\n----\n+++++\n@@ -10 +10,2 @@\n-- item\n+++ heading\n+- item\n"
+	if additions, deletions := countDiffLines(diff); additions != 3 || deletions != 2 {
+		t.Errorf("expected 3 additions and 2 deletions, got %d and %d", additions, deletions)
+	}
+}
@@ -0,0 +1,260 @@
+package gitnotify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Ref listings rarely change between runs. Responses are stored along with their ETag/Last-Modified
+// and the next request for the same url is sent with If-None-Match/If-Modified-Since.
+// A 304 is answered with the stored response, which does not count against github's rate limit
+
+const conditionalBucket = "gitnotify-conditional-requests"
+
+// entries are removed this long after they were stored. expired entries are looked for once a day
+const (
+	conditionalEntryTTL   = 7 * 24 * time.Hour
+	conditionalPurgeEvery = 24 * time.Hour
+)
+
+// conditionalEntry is the stored response of a request
+type conditionalEntry struct {
+	ETag         string      `json:"etag"`
+	LastModified string      `json:"last_modified"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	StoredAt     time.Time   `json:"stored_at"`
+}
+
+// conditionalStore persists entries keyed by url and token
+type conditionalStore interface {
+	get(key string) *conditionalEntry
+	put(key string, entry *conditionalEntry)
+}
+
+// conditionalScoper is implemented by token sources whose tokens rotate.
+// Responses are stored under the scope instead of the token so that they are used with the next token
+type conditionalScoper interface {
+	conditionalScope() string
+}
+
+// conditionalTransport sends conditional requests for GET requests accepted by match
+type conditionalTransport struct {
+	base  http.RoundTripper
+	store conditionalStore
+	match func(*http.Request) bool
+	scope string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *conditionalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" || t.store == nil || !t.match(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	key := conditionalKey(req, t.scope)
+	entry := t.store.get(key)
+	if entry != nil {
+		req = cloneRequest(req)
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		statCount("conditional.not_modified")
+		resp.Body.Close()
+		return entry.response(req, resp.Header), nil
+	}
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && lastModified == "") {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.store.put(key, &conditionalEntry{etag, lastModified, resp.Header, body, time.Now()})
+	statCount("conditional.stored")
+	return resp, nil
+}
+
+// response rebuilds the stored response. rate limit headers are taken from the 304 since they are current
+func (e *conditionalEntry) response(req *http.Request, notModified http.Header) *http.Response {
+	header := make(http.Header)
+	for k, v := range e.Header {
+		if !isRateLimitHeader(k) {
+			header[k] = v
+		}
+	}
+	for k, v := range notModified {
+		if isRateLimitHeader(k) {
+			header[k] = v
+		}
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// isRateLimitHeader matches the X-RateLimit-* headers of github and the RateLimit-* headers of gitlab
+func isRateLimitHeader(key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	return strings.HasPrefix(key, "X-Ratelimit-") || strings.HasPrefix(key, "Ratelimit-") || key == "Retry-After"
+}
+
+// isRefListing matches branch and tag listings of github and gitlab
+func isRefListing(req *http.Request) bool {
+	return strings.HasSuffix(req.URL.Path, "/branches") || strings.HasSuffix(req.URL.Path, "/tags")
+}
+
+// conditionalKey is unique per url and token since responses differ based on the user's access
+func conditionalKey(req *http.Request, scope string) string {
+	if scope != "" {
+		return scope + " " + req.URL.String()
+	}
+	token := sha256.Sum256([]byte(req.Header.Get("Authorization")))
+	return fmt.Sprintf("%x %s", token[:8], req.URL.String())
+}
+
+// cloneRequest is a shallow copy with its own headers. RoundTrippers should not modify the request
+func cloneRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	return r
+}
+
+// boltConditionalStore keeps a single handle open since bolt locks the file per handle
+type boltConditionalStore struct {
+	db *bolt.DB
+}
+
+var conditionalStoreOnce sync.Once
+var conditionalRequests conditionalStore
+
+// getConditionalStore opens conditional.db under the dataDir. requests are sent as usual when it cannot be opened
+func getConditionalStore() conditionalStore {
+	conditionalStoreOnce.Do(func() {
+		if conditionalRequests != nil {
+			return
+		}
+		db, err := bolt.Open(filepath.Join(config.DataDir, "conditional.db"), 0600, &bolt.Options{Timeout: 1 * time.Second})
+		if err != nil {
+			log.Printf("Conditional requests are disabled: %s", err)
+			return
+		}
+		store := &boltConditionalStore{db}
+		go func() {
+			for {
+				store.purge(time.Now().Add(-conditionalEntryTTL))
+				time.Sleep(conditionalPurgeEvery)
+			}
+		}()
+		conditionalRequests = store
+	})
+	return conditionalRequests
+}
+
+func (s *boltConditionalStore) get(key string) *conditionalEntry {
+	var entry *conditionalEntry
+	s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(conditionalBucket))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		entry = &conditionalEntry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			entry = nil
+		}
+		return nil
+	})
+	return entry
+}
+
+func (s *boltConditionalStore) put(key string, entry *conditionalEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(conditionalBucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+	if err != nil {
+		log.Printf("Could not store response for %s: %s", key, err)
+	}
+}
+
+// purge removes the entries stored before expired
+func (s *boltConditionalStore) purge(expired time.Time) {
+	var removed int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(conditionalBucket))
+		if b == nil {
+			return nil
+		}
+		// keys cannot be deleted while iterating
+		var keys [][]byte
+		b.ForEach(func(k, v []byte) error {
+			entry := &conditionalEntry{}
+			if json.Unmarshal(v, entry) != nil || entry.StoredAt.Before(expired) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Could not remove expired responses: %s", err)
+		return
+	}
+	statValue("conditional.purged", int64(removed))
+}
@@ -0,0 +1,123 @@
+package gitnotify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"golang.org/x/oauth2"
+)
+
+type memoryConditionalStore struct {
+	sync.Mutex
+	entries map[string]*conditionalEntry
+}
+
+func (s *memoryConditionalStore) get(key string) *conditionalEntry {
+	s.Lock()
+	defer s.Unlock()
+	return s.entries[key]
+}
+
+func (s *memoryConditionalStore) put(key string, entry *conditionalEntry) {
+	s.Lock()
+	defer s.Unlock()
+	s.entries[key] = entry
+}
+
+// tests do not write conditional.db
+func init() {
+	conditionalRequests = &memoryConditionalStore{entries: make(map[string]*conditionalEntry)}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	var notModified int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + r.Header.Get("Authorization") + `"`
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("X-Next-Page", "2")
+		w.Write([]byte(`[{"name":"master"}]`))
+	}))
+	defer ts.Close()
+
+	store := &memoryConditionalStore{entries: make(map[string]*conditionalEntry)}
+	newClient := func(token string) *http.Client {
+		return &http.Client{Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}),
+			Base:   &conditionalTransport{base: http.DefaultTransport, store: store, match: isRefListing},
+		}}
+	}
+
+	var list []*gitlabRef
+	for i, token := range []string{"first", "first", "second"} {
+		header, err := getJSONWithHeader(newClient(token), GitlabProvider, ts.URL+"/projects/1/repository/branches", &list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].Name != "master" || header.Get("X-Next-Page") != "2" {
+			t.Errorf("request %d: stored response was not served, got %v %v", i, list, header)
+		}
+	}
+	if notModified != 1 {
+		t.Errorf("expected 1 not modified response since tokens do not share responses, got %d", notModified)
+	}
+}
+
+func TestConditionalResponseRateLimitHeaders(t *testing.T) {
+	stored := http.Header{"Ratelimit-Remaining": {"600"}, "X-Ratelimit-Remaining": {"4999"}, "X-Next-Page": {"2"}}
+	entry := &conditionalEntry{ETag: `"a"`, Header: stored}
+	notModified := http.Header{"Ratelimit-Remaining": {"3"}, "Ratelimit-Reset": {"1500000000"}}
+
+	header := entry.response(&http.Request{}, notModified).Header
+	if header.Get("RateLimit-Remaining") != "3" || header.Get("RateLimit-Reset") != "1500000000" {
+		t.Errorf("expected the gitlab rate limit of the 304, got %v", header)
+	}
+	if header.Get("X-RateLimit-Remaining") != "" || header.Get("X-Next-Page") != "2" {
+		t.Errorf("expected stale rate limits to be dropped and other headers kept, got %v", header)
+	}
+}
+
+func TestConditionalKeyScope(t *testing.T) {
+	first, _ := http.NewRequest("GET", "https://api.github.com/repos/acme/widgets/branches", nil)
+	first.Header.Set("Authorization", "token first")
+	second, _ := http.NewRequest("GET", "https://api.github.com/repos/acme/widgets/branches", nil)
+	second.Header.Set("Authorization", "token second")
+
+	if conditionalKey(first, "") == conditionalKey(second, "") {
+		t.Error("expected responses of different tokens to be stored separately")
+	}
+	if conditionalKey(first, "installation-1") != conditionalKey(second, "installation-1") {
+		t.Error("expected responses of rotated installation tokens to be shared")
+	}
+}
+
+func TestBoltConditionalStorePurge(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "conditional.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := &boltConditionalStore{db}
+
+	now := time.Now()
+	store.put("old", &conditionalEntry{ETag: `"old"`, StoredAt: now.Add(-conditionalEntryTTL - time.Hour)})
+	store.put("new", &conditionalEntry{ETag: `"new"`, StoredAt: now})
+	store.purge(now.Add(-conditionalEntryTTL))
+
+	if store.get("old") != nil {
+		t.Error("expected the expired entry to be removed")
+	}
+	if store.get("new") == nil {
+		t.Error("expected the recent entry to be kept")
+	}
+}
@@ -10,29 +10,44 @@ import (
 
 // AppConfig is
 type AppConfig struct {
-	ServerProto         string   `yaml:"serverProto"`       // can be http:// or https://
-	ServerHost          string   `yaml:"serverHost"`        // domain.com with port . Used at redirection for OAuth
-	LocalHost           string   `yaml:"localHost"`         // host:port combination used for starting the server
-	DataDir             string   `yaml:"dataDir"`           // relative path from server to write the data
-	SettingsFile        string   `yaml:"settingsFile"`      // name of file to be looked up/saved to for data
-	FromName            string   `yaml:"fromName"`          // name of from email user
-	FromEmail           string   `yaml:"fromEmail"`         // email address of from email address
-	GithubAPIEndPoint   string   `yaml:"githubAPIEndPoint"` // server endpoint with protocol for https://api.github.com
-	GithubURLEndPoint   string   `yaml:"githubURLEndPoint"` // website end point https://github.com
-	GitlabAPIEndPoint   string   `yaml:"gitlabAPIEndPoint"` // server endpoint with protocol for https://gitlab.com/api/v3/
-	GitlabURLEndPoint   string   `yaml:"gitlabURLEndPoint"` // website end point https://gitlab.com
-	SMTPHost            string   `yaml:"smtpHost"`
-	SMTPPort            int      `yaml:"smtpPort"`
-	SMTPSesConfSet      string   `yaml:"sesConfigurationSet"` // ses configuration set used as a custom header while sending email
-	GoogleAnalytics     string   `yaml:"googleAnalytics"`
-	SMTPUser            string   // environment variable
-	SMTPPass            string   // environment variable
-	CacheMode           bool     `yaml:"cacheMode"` // when cacheMode is false, views are loaded on every request
-	WebhookIntegrations []string `yaml:"webhookIntegrations"`
-	StatHatKey          string   `yaml:"stathatKey"`
-	StatHatEnvironment  string   `yaml:"stathatEnvironment"` // Environment string is used to track Stats in StatHatKey
+	ServerProto           string   `yaml:"serverProto"`           // can be http:// or https://
+	ServerHost            string   `yaml:"serverHost"`            // domain.com with port . Used at redirection for OAuth
+	LocalHost             string   `yaml:"localHost"`             // host:port combination used for starting the server
+	DataDir               string   `yaml:"dataDir"`               // relative path from server to write the data
+	SettingsFile          string   `yaml:"settingsFile"`          // name of file to be looked up/saved to for data
+	FromName              string   `yaml:"fromName"`              // name of from email user
+	FromEmail             string   `yaml:"fromEmail"`             // email address of from email address
+	GithubAPIEndPoint     string   `yaml:"githubAPIEndPoint"`     // server endpoint with protocol for https://api.github.com
+	GithubURLEndPoint     string   `yaml:"githubURLEndPoint"`     // website end point https://github.com
+	GithubGraphQLEndPoint string   `yaml:"githubGraphQLEndPoint"` // https://api.github.com/graphql . refs are fetched in batches when set
+	GithubAppID           int64    `yaml:"githubAppID"`           // cron runs authenticate as the GitHub App instead of the user when set
+	GithubAppPrivateKey   string   `yaml:"githubAppPrivateKey"`   // path to the pem encoded private key of the GitHub App
+	GitlabAPIEndPoint     string   `yaml:"gitlabAPIEndPoint"`     // server endpoint with protocol for https://gitlab.com/api/v4/
+	GitlabURLEndPoint     string   `yaml:"gitlabURLEndPoint"`     // website end point https://gitlab.com
+	GitlabPageSize        int      `yaml:"gitlabPageSize"`        // items per page while listing branches/tags. defaults to 100
+	GitlabMaxPages        int      `yaml:"gitlabMaxPages"`        // maximum pages fetched for a listing. defaults to 50
+	CommitListLimit       int      `yaml:"commitListLimit"`       // commits listed for a changed branch. defaults to 10
+	ForcePushCheckMinutes int      `yaml:"forcePushCheckMinutes"` // interval for checking force pushes to notify immediately. 0 disables the checks
+	GiteaAPIEndPoint      string   `yaml:"giteaAPIEndPoint"`      // server endpoint with protocol for https://gitea.acme.com/api/v1/
+	GiteaURLEndPoint      string   `yaml:"giteaURLEndPoint"`      // website end point https://gitea.acme.com/
+	BitbucketAPIEndPoint  string   `yaml:"bitbucketAPIEndPoint"`  // server endpoint with protocol for https://bitbucket.acme.com/rest/api/1.0/
+	BitbucketURLEndPoint  string   `yaml:"bitbucketURLEndPoint"`  // website end point https://bitbucket.acme.com/
+	SMTPHost              string   `yaml:"smtpHost"`
+	SMTPPort              int      `yaml:"smtpPort"`
+	SMTPSesConfSet        string   `yaml:"sesConfigurationSet"` // ses configuration set used as a custom header while sending email
+	GoogleAnalytics       string   `yaml:"googleAnalytics"`
+	SMTPUser              string   // environment variable
+	SMTPPass              string   // environment variable
+	CacheMode             bool     `yaml:"cacheMode"` // when cacheMode is false, views are loaded on every request
+	WebhookIntegrations   []string `yaml:"webhookIntegrations"`
+	StatHatKey            string   `yaml:"stathatKey"`
+	StatHatEnvironment    string   `yaml:"stathatEnvironment"` // Environment string is used to track Stats in StatHatKey
 	// SentryURL           string   `yaml:"sentryDSN"`
 
+	GitLinkTemplates map[string]*GitLinkTemplates `yaml:"gitLinkTemplates"` // link templates for repos tracked by git url. keyed by host, "*" for any host
+	GitAllowFileURLs bool                         `yaml:"gitAllowFileURLs"` // allow tracking file:// repositories on the server
+	GitAllowedHosts  []string                     `yaml:"gitAllowedHosts"`  // hosts of repos tracked by git url. any public host when empty, listed hosts can be internal
+
 	TemplateDir         string `yaml:"templateDir"`         // tmpl/
 	TemplatePartialsDir string `yaml:"templatePartialsDir"` // tmpl/partials/
 	// "changes_mail" and "changes_mail_text" are the files used to render
@@ -58,6 +73,29 @@ func (c *AppConfig) isEmailSetup() bool {
 	return c.SMTPHost != ""
 }
 
+// number of items requested per page from gitlab. gitlab allows a maximum of 100
+func (c *AppConfig) gitlabPageSize() int {
+	if c.GitlabPageSize <= 0 || c.GitlabPageSize > 100 {
+		return 100
+	}
+	return c.GitlabPageSize
+}
+
+// safety cap on the number of pages fetched for a single listing
+func (c *AppConfig) gitlabMaxPages() int {
+	if c.GitlabMaxPages <= 0 {
+		return 50
+	}
+	return c.GitlabMaxPages
+}
+
+func (c *AppConfig) commitListLimit() int {
+	if c.CommitListLimit <= 0 {
+		return 10
+	}
+	return c.CommitListLimit
+}
+
 func (c *AppConfig) getStatHatPrefix() string {
 	if c.StatHatEnvironment != "" {
 		return c.StatHatEnvironment + "."
@@ -100,6 +138,7 @@ func LoadConfig(appConfigFile string) {
 	InitView()
 	initTZ()
 	preInitAuth()
+	loadGithubAppKey()
 
 	// variables used by views
 
@@ -111,10 +150,25 @@ func LoadConfig(appConfigFile string) {
 	}
 
 	if config.Providers[GitlabProvider] != "" {
-		gitlabRepoEndPoint = config.GitlabURLEndPoint + "%s/"                      // repo/abc
-		gitlabTreeURLEndPoint = config.GitlabURLEndPoint + "%s/tree/%s"            // repo/abc , develop
-		gitlabCommitURLEndPoint = config.GitlabURLEndPoint + "%s/commits/%s"       // repo/abc , develop
-		gitlabCompareURLEndPoint = config.GitlabURLEndPoint + "%s/compare/%s...%s" // repo/abc, base, target commit ref
+		gitlabRepoEndPoint = config.GitlabURLEndPoint + "%s/"                        // group/subgroup/abc
+		gitlabTreeURLEndPoint = config.GitlabURLEndPoint + "%s/-/tree/%s"            // group/subgroup/abc , develop
+		gitlabCommitURLEndPoint = config.GitlabURLEndPoint + "%s/-/commits/%s"       // group/subgroup/abc , develop
+		gitlabCompareURLEndPoint = config.GitlabURLEndPoint + "%s/-/compare/%s...%s" // group/subgroup/abc, base, target commit ref
+	}
+
+	if config.Providers[GiteaProvider] != "" {
+		giteaRepoEndPoint = config.GiteaURLEndPoint + "%s/"                      // repo/abc
+		giteaTreeURLEndPoint = config.GiteaURLEndPoint + "%s/src/%s"             // repo/abc , develop
+		giteaCommitURLEndPoint = config.GiteaURLEndPoint + "%s/commits/%s"       // repo/abc , develop
+		giteaCompareURLEndPoint = config.GiteaURLEndPoint + "%s/compare/%s...%s" // repo/abc, base, target commit ref
+	}
+
+	if config.Providers[BitbucketProvider] != "" {
+		bitbucketProjectEndPoint = config.BitbucketURLEndPoint + "projects/%s"                                                             // PROJ
+		bitbucketRepoEndPoint = config.BitbucketURLEndPoint + "projects/%s/repos/%s/browse"                                                // PROJ, abc
+		bitbucketTreeURLEndPoint = config.BitbucketURLEndPoint + "projects/%s/repos/%s/browse?at=%s"                                       // PROJ, abc, develop
+		bitbucketCommitURLEndPoint = config.BitbucketURLEndPoint + "projects/%s/repos/%s/commits?until=%s"                                 // PROJ, abc, develop
+		bitbucketCompareURLEndPoint = config.BitbucketURLEndPoint + "projects/%s/repos/%s/compare/commits?targetBranch=%s&sourceBranch=%s" // PROJ, abc, base, target commit ref
 	}
 
 	config.SourceCodeLink = "https://github.com/sairam/gitnotify"
@@ -20,8 +20,27 @@ var (
 	cronLocker   sync.Mutex
 	crons        *cron.Cron
 	runningCrons = make(map[string]cron.EntryID)
+	// runs postponed due to rate limiting. keyed by filename
+	postponedRuns = make(map[string]*time.Timer)
+
+	settingLocker sync.Mutex
+	// serialises load, process and save of a setting file between the runs and the web handlers. keyed by filename
+	settingLocks = make(map[string]*sync.Mutex)
 )
 
+// lockSetting locks the setting file and returns the function to unlock it
+func lockSetting(filename string) func() {
+	settingLocker.Lock()
+	l := settingLocks[filename]
+	if l == nil {
+		l = new(sync.Mutex)
+		settingLocks[filename] = l
+	}
+	settingLocker.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
 func isCronPresentFor(filename string) bool {
 	cronLocker.Lock()
 	id := runningCrons[filename]
@@ -76,6 +95,12 @@ func upsertCronEntry(s *Setting) {
 		return
 	}
 
+	if s.ReauthRequired {
+		log.Printf("Not starting cron for `%s` until the user logs in again\n", s.Auth.UserName)
+		stopCronIfAlreadyRunning(filename)
+		return
+	}
+
 	if s.User.Disabled == true {
 		log.Printf("User `%s` does not want any emails/notifications\n", s.Auth.UserName)
 		stopCronIfAlreadyRunning(filename)
@@ -114,6 +139,7 @@ func upsertCronEntry(s *Setting) {
 	}
 }
 
+// stopCronIfAlreadyRunning removes the cron and the postponed run. cronLocker should be held
 func stopCronIfAlreadyRunning(filename string) {
 	id := runningCrons[filename]
 	entry := crons.Entry(id)
@@ -121,6 +147,10 @@ func stopCronIfAlreadyRunning(filename string) {
 		crons.Remove(id)
 		runningCrons[filename] = 0
 	}
+	if timer := postponedRuns[filename]; timer != nil {
+		timer.Stop()
+		delete(postponedRuns, filename)
+	}
 }
 
 type cronJob struct {
@@ -129,18 +159,60 @@ type cronJob struct {
 }
 
 func (t cronJob) Run() {
-	filename := t.filename
-	conf := new(Setting)
 	statCount("cron.run")
-	log.Printf("Processing file through cron - %s", filename)
-	conf.load(filename)
-	processDiffForUser(conf)
-	if t.save {
-		conf.save(filename)
+	log.Printf("Processing file through cron - %s", t.filename)
+	err := t.process()
+	if reset, limited := isRateLimited(err); limited {
+		t.postpone(reset)
+		return
+	}
+	if isTokenExpired(err) {
+		requireReauth(t.filename)
+		return
 	}
 	statCount("cron.ran")
 }
 
+// process holds the lock of the setting file until the fetched information is saved
+func (t cronJob) process() error {
+	defer lockSetting(t.filename)()
+	conf := new(Setting)
+	conf.load(t.filename)
+	err := processDiffForUser(conf)
+	if stopsRun(err) {
+		return err
+	}
+	if t.save {
+		conf.PostponedUntil = nil
+		conf.save(t.filename)
+	}
+	return nil
+}
+
+// postpone retries the run once the rate limit resets. fetched information is not saved
+// since the refs of some repositories may not have been fetched. Runs that do not save are not retried
+func (t cronJob) postpone(until time.Time) {
+	if !t.save {
+		log.Printf("Stopped run for %s until %s due to rate limiting", t.filename, until)
+		return
+	}
+	statCount("cron.postponed")
+	log.Printf("Postponing run for %s until %s due to rate limiting", t.filename, until)
+	unlock := lockSetting(t.filename)
+	conf := new(Setting)
+	conf.load(t.filename)
+	conf.PostponedUntil = &until
+	conf.save(t.filename)
+	unlock()
+
+	cronLocker.Lock()
+	defer cronLocker.Unlock()
+	if timer := postponedRuns[t.filename]; timer != nil {
+		timer.Stop()
+	}
+	postponedRuns[t.filename] = time.AfterFunc(time.Until(until)+time.Minute, t.Run)
+}
+
 func startCronFor(cronEntry, filename string) {
 	id, _ := crons.AddJob(cronEntry, cronJob{filename, true})
 	runningCrons[filename] = id
@@ -157,6 +229,13 @@ func InitCron() {
 	if config.Providers[GitlabProvider] != "" {
 		go getData(GitlabProvider)
 	}
+	if config.Providers[GiteaProvider] != "" {
+		go getData(GiteaProvider)
+	}
+	if config.Providers[BitbucketProvider] != "" {
+		go getData(BitbucketProvider)
+	}
+	startForcePushChecks()
 }
 
 // There is no idiomatic way to compare SpecSchedule, put in a sort of adjustment
@@ -0,0 +1,156 @@
+package gitnotify
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Tracked branches of repositories with ForcePushAlert are checked every config.ForcePushCheckMinutes.
+// Force pushes are notified immediately and the new commit is stored, so the scheduled run continues from it
+
+func startForcePushChecks() {
+	if config.ForcePushCheckMinutes <= 0 {
+		return
+	}
+	crons.AddFunc(fmt.Sprintf("@every %dm", config.ForcePushCheckMinutes), checkForcePushes)
+}
+
+func checkForcePushes() {
+	statCount("cron.force_push_check")
+	for provider, name := range config.Providers {
+		if name == "" {
+			continue
+		}
+		for _, filename := range fetchFiles(provider) {
+			if filename == "" || !isCronPresentFor(filename) {
+				continue
+			}
+			checkForcePushesFor(filename)
+		}
+	}
+}
+
+func checkForcePushesFor(filename string) {
+	defer lockSetting(filename)()
+	conf := new(Setting)
+	conf.load(filename)
+	// the postponed run continues once the rate limit resets
+	if conf.PostponedUntil != nil && conf.PostponedUntil.After(time.Now()) {
+		return
+	}
+	if !conf.hasForcePushAlerts() {
+		return
+	}
+	err := processForcePushesForUser(conf)
+	if stopsRun(err) {
+		// the scheduled run handles the rate limits and expired tokens
+		log.Printf("Stopped checking force pushes for %s: %s", filename, err)
+		return
+	}
+	conf.save(filename)
+}
+
+func (c *Setting) hasForcePushAlerts() bool {
+	for _, repo := range c.Repos {
+		if repo.ForcePushAlert && len(repo.NamedReferences) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// processForcePushesForUser notifies the force pushed branches.
+// Only the tracked branches of the alert repos are fetched, in a batch when the provider supports it
+func processForcePushesForUser(conf *Setting) error {
+	var repos []*Repo
+	for _, repo := range conf.Repos {
+		if repo.ForcePushAlert && len(repo.NamedReferences) > 0 {
+			repos = append(repos, &Repo{Repo: repo.Repo, Provider: repo.Provider, NamedReferences: repo.NamedReferences})
+		}
+	}
+	prefetched := prefetchRefs(conf.Auth, repos)
+
+	var repoDiffs []*gitRepoDiffs
+	for _, repo := range conf.Repos {
+		if !repo.ForcePushAlert || len(repo.NamedReferences) == 0 {
+			continue
+		}
+		client := getGitClientForRepo(repo, conf.Auth)
+		if refs := prefetched[repo.Repo]; refs != nil {
+			client = &prefetchedClient{client, refs}
+		}
+		diff, err := processForcePushes(client, repo, conf.Info)
+		if stopsRun(err) {
+			return err
+		}
+		if err != nil {
+			log.Printf("Skipped checking force pushes for %s: %s", repo.Repo, err)
+			continue
+		}
+		if diff != nil {
+			repoDiffs = append(repoDiffs, diff)
+		}
+	}
+	if len(repoDiffs) == 0 {
+		return nil
+	}
+
+	statCount("notify.force_push")
+	diffs := makeRepoDiffs(repoDiffs, conf)
+	fileName, err := diffs.save(conf)
+	if err != nil {
+		fileName = ""
+	}
+	processForMail(diffs, conf, fileName)
+	processForWebhook(diffs, conf)
+	return nil
+}
+
+// processForcePushes returns the force pushed branches of the repo and stores their new commits.
+// Other changes are left for the scheduled run. Errors other than featureNotSupported are returned when they stop the run
+func processForcePushes(client GitRemoteIface, repo *Repo, info map[string]*Information) (*gitRepoDiffs, error) {
+	// force pushes are found by comparing the old and new commits
+	if _, ok := baseClient(client).(commitComparer); !ok {
+		return nil, featureNotSupported{repo.Provider, gitForcePush}
+	}
+	t := info[repo.Repo]
+	if t == nil {
+		return nil, nil
+	}
+	branches, err := client.Branches(repo.remoteName())
+	if stopsRun(err) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Failed fetching branches for %s: %s", repo.Repo, err)
+		return nil, nil
+	}
+
+	references := make(map[string]*gitCommitDiff)
+	for _, name := range repo.trackedBranches(branches) {
+		commit := &gitCommitDiff{OldCommit: t.Repo.Commits[name], NewCommit: findBranchCommit(branches, name)}
+		if commit.OldCommit != "" && commit.NewCommit != noneString && commit.changed() {
+			references[name] = commit
+		}
+	}
+	if err := compareCommits(client, repo, references); err != nil {
+		return nil, err
+	}
+	for name, commit := range references {
+		if !commit.forcePushed() {
+			delete(references, name)
+			continue
+		}
+		t.Repo.Commits[name] = commit.NewCommit
+	}
+	if len(references) == 0 {
+		return nil, nil
+	}
+	return &gitRepoDiffs{
+		RepoName:   repo.Repo,
+		Provider:   repo.Provider,
+		References: references,
+		Private:    repo.Private,
+	}, nil
+}
@@ -0,0 +1,128 @@
+package gitnotify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProcessRepoDiffFlagsForcePush(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", Provider: GithubProvider, NamedReferences: []reference{"master"}}
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		branches:     refs("master"),
+		comparison:   &gitComparison{Status: "diverged", BehindBy: 3, TotalCommits: 1},
+	}
+
+	diff, err := processRepoDiff(remote, repo, storedInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &Setting{Auth: &Authentication{Provider: GithubProvider}}
+	data := makeRepoDiffs([]*gitRepoDiffs{diff}, conf)[0].Data[0]
+	if !data.ForcePushed || data.DroppedCommits != 3 {
+		t.Errorf("expected a force push dropping 3 commits, got %+v", data)
+	}
+}
+
+func TestProcessForcePushes(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", NamedReferences: []reference{"master"}, ForcePushAlert: true}
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		branches:     refs("master"),
+		comparison:   &gitComparison{Status: "ahead", TotalCommits: 2},
+	}
+	info := storedInfo()
+
+	diff, err := processForcePushes(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != nil || info["acme/widgets"].Repo.Commits["master"] != "old-commit" {
+		t.Fatalf("fast forwards should be left for the scheduled run, got %v", diff)
+	}
+
+	remote.comparison = &gitComparison{Status: "behind", BehindBy: 2}
+	diff, err = processForcePushes(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff == nil || !diff.References["master"].forcePushed() {
+		t.Fatalf("expected the force push of master, got %v", diff)
+	}
+	if info["acme/widgets"].Repo.Commits["master"] != "master-commit" {
+		t.Errorf("expected the new commit to be stored, got %v", info["acme/widgets"].Repo.Commits)
+	}
+}
+
+func TestProcessForcePushesNotSupported(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", Provider: GiteaProvider, NamedReferences: []reference{"master"}, ForcePushAlert: true}
+	_, err := processForcePushes(&localGitnull{GiteaProvider}, repo, storedInfo())
+	if _, ok := err.(featureNotSupported); !ok {
+		t.Errorf("expected force push alerts to be not supported without comparing commits, got %v", err)
+	}
+}
+
+func TestCheckForcePushesSkipsPostponedRuns(t *testing.T) {
+	requests := 0
+	newFakeServer(t, &config.GithubAPIEndPoint, "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	dir, err := ioutil.TempDir("", "gitnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "settings.yml")
+	until := time.Now().Add(time.Hour)
+	conf := &Setting{
+		Auth:           &Authentication{Provider: GithubProvider, Token: "token"},
+		Repos:          []*Repo{{Repo: "acme/widgets", NamedReferences: []reference{"master"}, ForcePushAlert: true}},
+		Info:           storedInfo(),
+		PostponedUntil: &until,
+	}
+	if err := conf.save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	checkForcePushesFor(filename)
+	if requests != 0 {
+		t.Errorf("expected no requests while the run is postponed, got %d", requests)
+	}
+}
+
+func TestGitlabCompareStatus(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/42/repository/merge_base", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"id": "base"})
+	})
+	mux.HandleFunc("/api/v4/projects/42/repository/compare", func(w http.ResponseWriter, r *http.Request) {
+		commits := []map[string]string{{"id": "c1"}}
+		if r.URL.Query().Get("from") == "new" {
+			commits = append(commits, map[string]string{"id": "c2"})
+		}
+		diffs := []map[string]interface{}{
+			{"old_path": "cmd/old.go", "new_path": "cmd/new.go", "diff": "@@ -1 +1 @@\n-a\n+b\n"},
+			{"old_path": "vendor/lib.go", "new_path": "vendor/lib.go", "collapsed": true},
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"commits": commits, "diffs": diffs})
+	})
+	newFakeServer(t, &config.GitlabAPIEndPoint, "/api/v4/", mux)
+
+	comparison, err := newGitlabClient("token").Compare("42", "old", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison.Status != "diverged" || comparison.BehindBy != 2 || comparison.TotalCommits != 1 {
+		t.Errorf("expected a diverged comparison dropping 2 commits, got %+v", comparison)
+	}
+	if f := comparison.Files[0]; f.PreviousPath != "cmd/old.go" || comparison.Files[1].PreviousPath != "" || !comparison.FilesLeftOut {
+		t.Errorf("expected the previous name of the renamed file and the collapsed diff to leave out files, got %+v", comparison)
+	}
+}
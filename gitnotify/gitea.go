@@ -0,0 +1,320 @@
+package gitnotify
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/markbates/goth"
+	"golang.org/x/oauth2"
+)
+
+/*
+Gitea and Forgejo share the same API. Example:
+  [{
+    "name":"master",
+    "commit":{
+      "id":"c36c69c0613a359a41fe5da8e70047bffe7f97c2"
+    }
+  }]
+*/
+
+// number of items requested per page. Gitea caps this with MAX_RESPONSE_ITEMS (50 by default)
+const giteaPageSize = 50
+
+type localGitea struct {
+	client GitClient
+}
+
+// Helpers
+
+func (*localGitea) WebsiteLink() string {
+	return config.GiteaURLEndPoint
+}
+
+func (*localGitea) RepoLink(repo string) string {
+	return fmt.Sprintf(giteaRepoEndPoint, repo)
+}
+
+func (*localGitea) TreeLink(repo, ref string) string {
+	return fmt.Sprintf(giteaTreeURLEndPoint, repo, ref)
+}
+
+func (*localGitea) CommitLink(repo, ref string) string {
+	return fmt.Sprintf(giteaCommitURLEndPoint, repo, ref)
+}
+
+func (*localGitea) CompareLink(repo, oldCommit, newCommit string) string {
+	return fmt.Sprintf(giteaCompareURLEndPoint, repo, oldCommit, newCommit)
+}
+
+func (g *localGitea) Client() *http.Client {
+	return g.client.(*http.Client)
+}
+
+func newGiteaClient(token string) *localGitea {
+	if token == "" {
+		return &localGitea{}
+	}
+	return newGiteaClientFor(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+}
+
+func newGiteaClientFor(ts oauth2.TokenSource) *localGitea {
+	return &localGitea{newAPIClient(ts, nil)}
+}
+
+// get requests path relative to giteaAPIEndPoint and decodes the json response into v
+func (g *localGitea) get(path string, query url.Values, v interface{}) error {
+	u := config.GiteaAPIEndPoint + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return getJSON(g.Client(), GiteaProvider, u, v)
+}
+
+// getPage requests a page from paginate and also returns the headers which contain the total count
+func (g *localGitea) getPage(pagePath string, v interface{}) (http.Header, error) {
+	return getJSONWithHeader(g.Client(), GiteaProvider, config.GiteaAPIEndPoint+pagePath, v)
+}
+
+// paginate calls fetch with the path for every page starting from 1 until X-Total-Count items
+// were fetched or a page is empty. Pages can be shorter than giteaPageSize when the instance caps them
+func (g *localGitea) paginate(path string, query url.Values, fetch func(pagePath string) (int, http.Header, error)) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("limit", fmt.Sprintf("%d", giteaPageSize))
+	fetched := 0
+	for page := 1; page < 100; page++ {
+		query.Set("page", fmt.Sprintf("%d", page))
+		count, header, err := fetch(path + "?" + query.Encode())
+		if err != nil {
+			return err
+		}
+		fetched += count
+		total, err := strconv.Atoi(header.Get("X-Total-Count"))
+		if count == 0 || (err == nil && fetched >= total) {
+			break
+		}
+	}
+	return nil
+}
+
+func (g *localGitea) repoPath(repoName string) string {
+	ownerRepo := strings.SplitN(repoName, "/", 2)
+	if len(ownerRepo) != 2 {
+		return "repos/" + url.PathEscape(repoName)
+	}
+	return "repos/" + url.PathEscape(ownerRepo[0]) + "/" + url.PathEscape(ownerRepo[1])
+}
+
+type giteaBranch struct {
+	Name   string `json:"name"`
+	Commit struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+}
+
+type giteaTag struct {
+	Name   string `json:"name"`
+	Commit struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+type giteaRepo struct {
+	Name          string `json:"name"`
+	FullName      string `json:"full_name"`
+	Description   string `json:"description"`
+	Website       string `json:"website"`
+	DefaultBranch string `json:"default_branch"`
+	Private       bool   `json:"private"`
+}
+
+type giteaUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+}
+
+// fetchGiteaUser is used at the time of login to fill in the user's profile
+func fetchGiteaUser(token string, user *goth.User) error {
+	u := struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		FullName  string `json:"full_name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+	}{}
+	if err := newGiteaClient(token).get("user", nil, &u); err != nil {
+		return err
+	}
+
+	user.UserID = fmt.Sprintf("%d", u.ID)
+	user.NickName = u.Login
+	user.Name = u.FullName
+	user.Email = u.Email
+	user.AvatarURL = u.AvatarURL
+	return nil
+}
+
+func (g *localGitea) Branches(repoName string) ([]*GitRefWithCommit, error) {
+	statCount("gitea.branches")
+	refs := make([]*GitRefWithCommit, 0, giteaPageSize)
+	err := g.paginate(g.repoPath(repoName)+"/branches", nil, func(pagePath string) (int, http.Header, error) {
+		var list []*giteaBranch
+		header, err := g.getPage(pagePath, &list)
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, b := range list {
+			refs = append(refs, &GitRefWithCommit{Name: b.Name, Commit: b.Commit.ID})
+		}
+		return len(list), header, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (g *localGitea) BranchesWithoutRefs(repoName string) ([]string, error) {
+	statCount("gitea.branches_without_refs")
+	listBranches, err := g.Branches(repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	branches := make([]string, 0, len(listBranches))
+	for _, b := range listBranches {
+		branches = append(branches, b.Name)
+	}
+	return branches, nil
+}
+
+func (g *localGitea) Tags(repoName string) ([]*GitRefWithCommit, error) {
+	statCount("gitea.tags")
+	refs := make([]*GitRefWithCommit, 0, giteaPageSize)
+	err := g.paginate(g.repoPath(repoName)+"/tags", nil, func(pagePath string) (int, http.Header, error) {
+		var list []*giteaTag
+		header, err := g.getPage(pagePath, &list)
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, t := range list {
+			refs = append(refs, &GitRefWithCommit{Name: t.Name, Commit: t.Commit.SHA})
+		}
+		return len(list), header, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (g *localGitea) DefaultBranch(repoName string) (string, error) {
+	statCount("gitea.default_branch")
+	repository := &giteaRepo{}
+	if err := g.get(g.repoPath(repoName), nil, repository); err != nil {
+		return "", err
+	}
+	return repository.DefaultBranch, nil
+}
+
+func (g *localGitea) SearchRepos(query string) ([]*searchRepoItem, error) {
+	statCount("gitea.search_repos")
+	result := &struct {
+		Data []*giteaRepo `json:"data"`
+	}{}
+	q := url.Values{"q": {strings.TrimSpace(query)}, "limit": {fmt.Sprintf("%d", giteaPageSize)}}
+	if err := g.get("repos/search", q, result); err != nil {
+		return nil, err
+	}
+
+	searchResults := make([]*searchRepoItem, 0, len(result.Data))
+	for _, r := range result.Data {
+		searchResults = append(searchResults, &searchRepoItem{
+			ID:          r.Name,
+			Name:        r.FullName,
+			Description: r.Description,
+			HomePage:    r.Website,
+		})
+	}
+	return searchResults, nil
+}
+
+func (g *localGitea) SearchUsers(query string) ([]*searchUserItem, error) {
+	statCount("gitea.search_users")
+	result := &struct {
+		Data []*giteaUser `json:"data"`
+	}{}
+	if err := g.get("users/search", url.Values{"q": {query}}, result); err != nil {
+		return []*searchUserItem{}, err
+	}
+
+	searchResults := make([]*searchUserItem, 0, len(result.Data))
+	for _, r := range result.Data {
+		searchResults = append(searchResults, &searchUserItem{
+			ID:    fmt.Sprintf("%d", r.ID),
+			Login: r.Login,
+			Type:  "User",
+		})
+	}
+	return searchResults, nil
+}
+
+// RemoteOrgType returns Organization or User to be in sync with github
+func (g *localGitea) RemoteOrgType(name string) (string, error) {
+	statCount("gitea.remote_org_type")
+	org := &giteaUser{}
+	err := g.get("orgs/"+url.PathEscape(name), nil, org)
+	if err == nil {
+		return "Organization", nil
+	}
+	if !isNotFound(err) {
+		return "", err
+	}
+
+	user := &giteaUser{}
+	if err := g.get("users/"+url.PathEscape(name), nil, user); err != nil {
+		return "", err
+	}
+	return "User", nil
+}
+
+func (g *localGitea) ReposForUser(organisation string) ([]*searchRepoItem, error) {
+	statCount("gitea.repos_for_user")
+	orgType, err := g.RemoteOrgType(organisation)
+	if err != nil {
+		return nil, err
+	}
+
+	path := "users/" + url.PathEscape(organisation) + "/repos"
+	if orgType == "Organization" {
+		path = "orgs/" + url.PathEscape(organisation) + "/repos"
+	}
+
+	var repoList []*searchRepoItem
+	err = g.paginate(path, nil, func(pagePath string) (int, http.Header, error) {
+		var repositories []*giteaRepo
+		header, err := g.getPage(pagePath, &repositories)
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, repo := range repositories {
+			repoList = append(repoList, &searchRepoItem{
+				ID:          repo.Name,
+				Name:        repo.Name,
+				Description: repo.Description,
+				HomePage:    repo.Website,
+				Private:     repo.Private,
+			})
+		}
+		return len(repositories), header, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repoList, nil
+}
@@ -0,0 +1,80 @@
+package gitnotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// newFakeGitea serves a minimal subset of the gitea api with branchCount branches.
+// Pages are capped at 30 items like an instance with MAX_RESPONSE_ITEMS = 30
+func newFakeGitea(t *testing.T, branchCount int) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/acme/widgets/branches", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if limit > 30 {
+			limit = 30
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(branchCount))
+		var list []*giteaBranch
+		for i := (page - 1) * limit; i < page*limit && i < branchCount; i++ {
+			b := &giteaBranch{Name: fmt.Sprintf("branch-%03d", i)}
+			b.Commit.ID = fmt.Sprintf("%040d", i)
+			list = append(list, b)
+		}
+		json.NewEncoder(w).Encode(list)
+	})
+	mux.HandleFunc("/api/v1/repos/acme/widgets", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&giteaRepo{Name: "widgets", FullName: "acme/widgets", DefaultBranch: "main"})
+	})
+	mux.HandleFunc("/api/v1/orgs/acme", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&giteaUser{ID: 1, Login: "acme"})
+	})
+	mux.HandleFunc("/api/v1/users/jdoe", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&giteaUser{ID: 2, Login: "jdoe"})
+	})
+	newFakeServer(t, &config.GiteaAPIEndPoint, "/api/v1/", mux)
+}
+
+func TestGiteaBranchesPaginates(t *testing.T) {
+	newFakeGitea(t, 120)
+
+	refs, err := newGiteaClient("token").Branches("acme/widgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 120 {
+		t.Fatalf("expected 120 branches, got %d", len(refs))
+	}
+	if refs[119].Name != "branch-119" || refs[119].Commit != fmt.Sprintf("%040d", 119) {
+		t.Errorf("unexpected last ref %v", refs[119])
+	}
+}
+
+func TestGiteaDefaultBranch(t *testing.T) {
+	newFakeGitea(t, 0)
+
+	client := newGiteaClient("token")
+	branch, err := client.DefaultBranch("acme/widgets")
+	if err != nil || branch != "main" {
+		t.Errorf("expected main, got %q (%v)", branch, err)
+	}
+	if _, err := client.DefaultBranch("acme/missing"); err == nil {
+		t.Error("expected an error for a missing repository")
+	}
+}
+
+func TestGiteaRemoteOrgType(t *testing.T) {
+	newFakeGitea(t, 0)
+
+	client := newGiteaClient("token")
+	for name, expected := range map[string]string{"acme": "Organization", "jdoe": "User", "nobody": ""} {
+		orgType, _ := client.RemoteOrgType(name)
+		if orgType != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, orgType)
+		}
+	}
+}
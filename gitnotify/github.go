@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,6 +16,23 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// pull requests and issues are listed up to these many pages of 100 between runs
+const githubPullRequestMaxPages = 10
+
+// comparisons list at most these many files
+const githubCompareMaxFiles = 300
+
+// the latest commits of large comparisons are fetched in pages of
+const githubComparePerPage = 100
+
+type githubTooManyPages struct {
+	path string
+}
+
+func (e githubTooManyPages) Error() string {
+	return fmt.Sprintf("github: more than %d pages for %s", githubPullRequestMaxPages, e.path)
+}
+
 type localGithub struct {
 	client GitClient
 }
@@ -49,7 +67,11 @@ func newGithubClient(token string) *localGithub {
 		return &localGithub{}
 	}
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tc := oauth2.NewClient(oauth2.NoContext, ts)
+	return newGithubClientFor(newAPIClient(ts, isRefListing))
+}
+
+// newGithubClientFor uses the http client to authenticate
+func newGithubClientFor(tc *http.Client) *localGithub {
 	client := githubApp.NewClient(tc)
 	var err error
 	client.BaseURL, err = url.Parse(config.GithubAPIEndPoint)
@@ -91,12 +113,11 @@ func (g *localGithub) Branches(repoName string) ([]*GitRefWithCommit, error) {
 		statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
 		statCount("github.api_call")
 
-		if len(list) == 0 || err != nil || gr.StatusCode >= 400 {
-			page = page + 1
-			if page >= 100 {
-				break
-			}
-			continue
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			break
 		}
 
 		for _, r := range list {
@@ -131,12 +152,11 @@ func (g *localGithub) Tags(repoName string) ([]*GitRefWithCommit, error) {
 		statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
 		statCount("github.api_call")
 
-		if len(list) == 0 || err != nil || gr.StatusCode >= 400 {
-			page = page + 1
-			if page >= 100 {
-				break
-			}
-			continue
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			break
 		}
 
 		for _, r := range list {
@@ -152,6 +172,214 @@ func (g *localGithub) Tags(repoName string) ([]*GitRefWithCommit, error) {
 	return refs, nil
 }
 
+// Releases returns the latest page of published releases, newest first
+func (g *localGithub) Releases(repoName string) ([]*GitRelease, error) {
+	statCount("github.releases")
+	ownerRepo := strings.SplitN(repoName, "/", 2)
+	opt := &githubApp.ListOptions{PerPage: 100}
+	start := time.Now()
+	list, _, err := g.Client().Repositories.ListReleases(context.TODO(), ownerRepo[0], ownerRepo[1], opt)
+	statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
+	statCount("github.api_call")
+	if err != nil {
+		return nil, err
+	}
+
+	releases := make([]*GitRelease, 0, len(list))
+	for _, r := range list {
+		// drafts are listed only for users with push access
+		if r.GetDraft() {
+			continue
+		}
+		releases = append(releases, &GitRelease{
+			ID:         strconv.FormatInt(r.GetID(), 10),
+			Name:       r.GetName(),
+			Tag:        r.GetTagName(),
+			Prerelease: r.GetPrerelease(),
+			Body:       r.GetBody(),
+			URL:        r.GetHTMLURL(),
+		})
+	}
+	return releases, nil
+}
+
+// PullRequests returns the pull requests updated after since, recently updated first.
+// github does not filter by time, pages are listed until an older pull request is found
+func (g *localGithub) PullRequests(repoName string, since time.Time) ([]*GitPullRequest, error) {
+	statCount("github.pull_requests")
+	ownerRepo := strings.SplitN(repoName, "/", 2)
+	opt := &githubApp.PullRequestListOptions{
+		State:       "all",
+		Sort:        "updated",
+		Direction:   "desc",
+		ListOptions: githubApp.ListOptions{PerPage: 100},
+	}
+
+	var pulls []*GitPullRequest
+	page := 1
+	for page != 0 && page <= githubPullRequestMaxPages {
+		opt.Page = page
+		start := time.Now()
+		list, gr, err := g.Client().PullRequests.List(context.TODO(), ownerRepo[0], ownerRepo[1], opt)
+		statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
+		statCount("github.api_call")
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range list {
+			if !p.GetUpdatedAt().After(since) {
+				return pulls, nil
+			}
+			pull := &GitPullRequest{
+				Number:    p.GetNumber(),
+				Title:     p.GetTitle(),
+				Author:    p.GetUser().GetLogin(),
+				Base:      p.GetBase().GetRef(),
+				URL:       p.GetHTMLURL(),
+				CreatedAt: p.GetCreatedAt(),
+				UpdatedAt: p.GetUpdatedAt(),
+				MergedAt:  p.GetMergedAt(),
+				ClosedAt:  p.GetClosedAt(),
+			}
+			for _, l := range p.Labels {
+				pull.Labels = append(pull.Labels, l.GetName())
+			}
+			pulls = append(pulls, pull)
+		}
+		page = gr.NextPage
+	}
+	if page != 0 {
+		return nil, githubTooManyPages{repoName + " pull requests"}
+	}
+	return pulls, nil
+}
+
+// Issues returns the issues updated after since, newest first. Pull requests are listed as issues by github and are left out
+func (g *localGithub) Issues(repoName string, since time.Time) ([]*GitIssue, error) {
+	statCount("github.issues")
+	ownerRepo := strings.SplitN(repoName, "/", 2)
+	opt := &githubApp.IssueListByRepoOptions{
+		State:       "all",
+		Sort:        "updated",
+		Direction:   "desc",
+		Since:       since,
+		ListOptions: githubApp.ListOptions{PerPage: 100},
+	}
+
+	var issues []*GitIssue
+	page := 1
+	for page != 0 && page <= githubPullRequestMaxPages {
+		opt.Page = page
+		start := time.Now()
+		list, gr, err := g.Client().Issues.ListByRepo(context.TODO(), ownerRepo[0], ownerRepo[1], opt)
+		statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
+		statCount("github.api_call")
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range list {
+			if !i.GetUpdatedAt().After(since) {
+				return issues, nil
+			}
+			if i.IsPullRequest() {
+				continue
+			}
+			issue := &GitIssue{
+				Number:    i.GetNumber(),
+				Title:     i.GetTitle(),
+				Author:    i.GetUser().GetLogin(),
+				State:     i.GetState(),
+				URL:       i.GetHTMLURL(),
+				CreatedAt: i.GetCreatedAt(),
+				UpdatedAt: i.GetUpdatedAt(),
+			}
+			for _, l := range i.Labels {
+				issue.Labels = append(issue.Labels, l.GetName())
+			}
+			issues = append(issues, issue)
+		}
+		page = gr.NextPage
+	}
+	if page != 0 {
+		return nil, githubTooManyPages{repoName + " issues"}
+	}
+	return issues, nil
+}
+
+// Compare lists up to 250 commits and 300 files. TotalCommits has the actual count
+// githubCompare adds the previous name of renamed files missing in the client
+type githubCompare struct {
+	githubApp.CommitsComparison
+	Files []struct {
+		Filename         string `json:"filename"`
+		PreviousFilename string `json:"previous_filename"`
+		Additions        int    `json:"additions"`
+		Deletions        int    `json:"deletions"`
+	} `json:"files"`
+}
+
+// compare fetches a comparison. query paginates the commits
+func (g *localGithub) compare(ownerRepo []string, oldCommit, newCommit, query string) (*githubCompare, error) {
+	u := fmt.Sprintf("repos/%s/%s/compare/%s...%s%s", ownerRepo[0], ownerRepo[1], oldCommit, newCommit, query)
+	req, err := g.Client().NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	comparison := new(githubCompare)
+	start := time.Now()
+	_, err = g.Client().Do(context.TODO(), req, comparison)
+	statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
+	statCount("github.api_call")
+	return comparison, err
+}
+
+// Compare lists the oldest 250 commits. The latest commits are fetched from the last pages when there are more
+func (g *localGithub) Compare(repoName, oldCommit, newCommit string) (*gitComparison, error) {
+	statCount("github.compare")
+	ownerRepo := strings.SplitN(repoName, "/", 2)
+	comparison, err := g.compare(ownerRepo, oldCommit, newCommit, "")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &gitComparison{
+		TotalCommits: comparison.GetTotalCommits(),
+		Status:       comparison.GetStatus(),
+		BehindBy:     comparison.GetBehindBy(),
+	}
+	commits := comparison.Commits
+	if result.TotalCommits > len(commits) {
+		commits = nil
+		for page := (result.TotalCommits + githubComparePerPage - 1) / githubComparePerPage; page > 0 && len(commits) < config.commitListLimit(); page-- {
+			statCount("github.compare_page")
+			latest, err := g.compare(ownerRepo, oldCommit, newCommit, fmt.Sprintf("?per_page=%d&page=%d", githubComparePerPage, page))
+			if err != nil {
+				return nil, err
+			}
+			commits = append(latest.Commits, commits...)
+		}
+	}
+	for _, c := range commits {
+		result.Commits = append(result.Commits, &GitCommit{
+			SHA:     c.GetSHA(),
+			Author:  c.GetCommit().GetAuthor().GetName(),
+			Date:    c.GetCommit().GetAuthor().GetDate(),
+			Message: c.GetCommit().GetMessage(),
+		})
+	}
+	// github lists at most 300 files
+	result.FilesLeftOut = len(comparison.Files) >= githubCompareMaxFiles
+	for _, f := range comparison.Files {
+		result.Files = append(result.Files, &GitFileChange{
+			Path:         f.Filename,
+			PreviousPath: f.PreviousFilename,
+			Additions:    f.Additions,
+			Deletions:    f.Deletions,
+		})
+	}
+	return result, nil
+}
+
 func (g *localGithub) DefaultBranch(repoName string) (string, error) {
 	statCount("github.default_branch")
 	ownerRepo := strings.SplitN(repoName, "/", 2)
@@ -168,6 +396,43 @@ func (g *localGithub) DefaultBranch(repoName string) (string, error) {
 	return *repository.DefaultBranch, err
 }
 
+func (g *localGithub) IsPrivate(repoName string) (bool, error) {
+	statCount("github.is_private")
+	ownerRepo := strings.SplitN(repoName, "/", 2)
+	start := time.Now()
+	repository, _, err := g.Client().Repositories.Get(context.TODO(), ownerRepo[0], ownerRepo[1])
+	statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
+	statCount("github.api_call")
+
+	if e, ok := err.(*githubApp.ErrorResponse); ok {
+		return false, &remoteError{GithubProvider, e.Response.StatusCode, e.Response.Request.URL.String()}
+	}
+	if err != nil {
+		return false, err
+	}
+	return repository.GetPrivate(), nil
+}
+
+// Scopes are returned by github in the X-OAuth-Scopes header of every request made with an oauth token
+func (g *localGithub) Scopes() ([]string, error) {
+	statCount("github.scopes")
+	start := time.Now()
+	_, gr, err := g.Client().Users.Get(context.TODO(), "")
+	statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
+	statCount("github.api_call")
+	if err != nil {
+		return nil, err
+	}
+
+	var scopes []string
+	for _, scope := range strings.Split(gr.Header.Get("X-OAuth-Scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
 type ghSearchRepo struct {
 	Items []*searchRepoItem `json:"items"`
 }
@@ -273,12 +538,8 @@ func (g *localGithub) ReposForUser(organisation string) ([]*searchRepoItem, erro
 		repositories, gr, err := g.Client().Repositories.List(context.TODO(), organisation, opt)
 		statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
 		statCount("github.api_call")
-		if err != nil || gr.StatusCode >= 400 {
-			page = page + 1
-			if page >= 100 {
-				break
-			}
-			continue
+		if err != nil {
+			return nil, err
 		}
 		var repos = make([]*searchRepoItem, 0, len(repositories))
 		for _, repo := range repositories {
@@ -291,6 +552,7 @@ func (g *localGithub) ReposForUser(organisation string) ([]*searchRepoItem, erro
 			if repo.Description != nil {
 				item.Description = *repo.Description
 			}
+			item.Private = repo.GetPrivate()
 			repos = append(repos, item)
 		}
 		repoList = append(repoList, repos...)
@@ -0,0 +1,103 @@
+package gitnotify
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGithubPrivateRepos(t *testing.T) {
+	newFakeServer(t, &config.GithubAPIEndPoint, "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/widgets":
+			w.Write([]byte(`{"name": "widgets", "private": true, "default_branch": "master"}`))
+		case "/user":
+			w.Header().Set("X-OAuth-Scopes", "repo, user:email")
+			w.Write([]byte(`{"login": "acme"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not Found"}`))
+		}
+	}))
+
+	scopes := grantedScopes(GithubProvider, "token")
+	if !reflect.DeepEqual(scopes, []string{"repo", "user:email"}) {
+		t.Errorf("expected scopes from the header, got %v", scopes)
+	}
+
+	public := &Authentication{Provider: GithubProvider, Token: "token", Scopes: []string{"user:email"}}
+	private, err := validateRemoteRepoName(GithubProvider, public, "acme/widgets")
+	if err != nil || !private {
+		t.Errorf("expected a private repository, got %v %v", private, err)
+	}
+	if _, err := validateRemoteRepoName(GithubProvider, public, "acme/secret"); err != errRepoNoAccess {
+		t.Errorf("a missing repository may be private without the %s scope, got %v", githubPrivateScope, err)
+	}
+	if public.privateAccessURL() != "/auth/github/private" {
+		t.Errorf("expected a url to grant private access, got %s", public.privateAccessURL())
+	}
+
+	granted := &Authentication{Provider: GithubProvider, Token: "token", Scopes: scopes}
+	if _, err := validateRemoteRepoName(GithubProvider, granted, "acme/secret"); err != errRepoNotFound {
+		t.Errorf("expected repository to be not found, got %v", err)
+	}
+	if granted.privateAccessURL() != "" {
+		t.Errorf("access is already granted, got %s", granted.privateAccessURL())
+	}
+
+	info := make(map[string]*Information)
+	now := time.Now()
+	repo := &Repo{Repo: "acme/widgets"}
+	resolveRepoVisibility(getGitClient(GithubProvider, "token"), repo, info, now)
+	if !repo.Private {
+		t.Errorf("expected the repository to be private after it was made private")
+	}
+	repo.Private = false
+	resolveRepoVisibility(getGitClient(GithubProvider, "token"), repo, info, now.Add(time.Hour))
+	if repo.Private {
+		t.Errorf("expected the visibility to be fetched once a day")
+	}
+	resolveRepoVisibility(getGitClient(GithubProvider, "token"), repo, info, now.Add(repoVisibilityTTL))
+	if !repo.Private {
+		t.Errorf("expected the visibility to be refreshed after a day")
+	}
+	missing := &Repo{Repo: "acme/secret", Private: true}
+	resolveRepoVisibility(getGitClient(GithubProvider, "token"), missing, info, now)
+	if !missing.Private {
+		t.Errorf("expected the stored visibility to be kept when it cannot be fetched")
+	}
+}
+
+func TestGithubCompareFiles(t *testing.T) {
+	fileCount := 2
+	newFakeServer(t, &config.GithubAPIEndPoint, "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/widgets/compare/old...new" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		files := []map[string]interface{}{{"filename": "cmd/new.go", "previous_filename": "cmd/old.go", "additions": 2}}
+		for len(files) < fileCount {
+			files = append(files, map[string]interface{}{"filename": "docs/index.md", "deletions": 1})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "ahead", "total_commits": 1, "files": files})
+	}))
+
+	client := getGitClient(GithubProvider, "token").(commitComparer)
+	comparison, err := client.Compare("acme/widgets", "old", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison.Status != "ahead" || comparison.FilesLeftOut || len(comparison.Files) != 2 {
+		t.Fatalf("unexpected comparison %+v", comparison)
+	}
+	if f := comparison.Files[0]; f.Path != "cmd/new.go" || f.PreviousPath != "cmd/old.go" || f.Additions != 2 {
+		t.Errorf("expected the previous name of the renamed file, got %+v", f)
+	}
+
+	fileCount = githubCompareMaxFiles
+	if comparison, err = client.Compare("acme/widgets", "old", "new"); err != nil || !comparison.FilesLeftOut {
+		t.Errorf("expected files to be left out at %d files, got %v", githubCompareMaxFiles, err)
+	}
+}
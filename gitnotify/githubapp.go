@@ -0,0 +1,284 @@
+package gitnotify
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// When gitnotify is configured as a GitHub App, cron runs fetch github repositories with installation tokens.
+// The user's oauth token is used only for login and the web pages.
+// A JWT signed with the app's private key is exchanged for an installation token which is valid for an hour
+
+// installation tokens are refreshed this long before they expire
+const installationTokenLeeway = 5 * time.Minute
+
+// installations covering a repository or account are looked up again after this long
+const installationLookupTTL = time.Hour
+
+// requests made as the app give up after this long
+const githubAppRequestTimeout = 30 * time.Second
+
+var githubAppHTTPClient = &http.Client{Timeout: githubAppRequestTimeout}
+
+var githubAppKey *rsa.PrivateKey
+
+type githubAppNotInstalled struct {
+	name string
+}
+
+func (e githubAppNotInstalled) Error() string {
+	return fmt.Sprintf("the GitHub App is not installed for %s", e.name)
+}
+
+func (c *AppConfig) isGithubAppSetup() bool {
+	return c.GithubAppID != 0 && githubAppKey != nil
+}
+
+// loadGithubAppKey reads the pem encoded private key generated for the app
+func loadGithubAppKey() {
+	if config.GithubAppID == 0 {
+		return
+	}
+	if config.GithubAppPrivateKey == "" {
+		panic("Missing Configuration: Github App private key is not set!")
+	}
+	data, err := ioutil.ReadFile(config.GithubAppPrivateKey)
+	if err != nil {
+		panic(err)
+	}
+	githubAppKey, err = parseRSAPrivateKey(data)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not pem encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an rsa key")
+	}
+	return rsaKey, nil
+}
+
+// githubAppJWT authenticates as the app. github allows a maximum expiry of 10 minutes
+func githubAppJWT() (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(), // allows for clock drift
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": config.GithubAppID,
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, githubAppKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// githubAppRequest makes a request authenticated as the app and decodes the json response into v
+func githubAppRequest(method, path string, v interface{}) error {
+	jwt, err := githubAppJWT()
+	if err != nil {
+		return err
+	}
+	u := config.GithubAPIEndPoint + path
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+
+	start := time.Now()
+	resp, err := githubAppHTTPClient.Do(req)
+	statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
+	statCount("github.api_call")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return &remoteError{GithubProvider, resp.StatusCode, u}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type installationLookup struct {
+	id      int64 // 0 when the app is not installed
+	expires time.Time
+}
+
+var installations = struct {
+	sync.Mutex
+	lookups map[string]*installationLookup
+	tokens  map[int64]*oauth2.Token
+	clients map[int64]*localGithub
+}{lookups: make(map[string]*installationLookup), tokens: make(map[int64]*oauth2.Token), clients: make(map[int64]*localGithub)}
+
+// githubInstallation returns the installation covering the path. 0 when the app is not installed
+// path is repos/owner/repo, orgs/org or users/user
+func githubInstallation(path string) (int64, error) {
+	installations.Lock()
+	lookup := installations.lookups[path]
+	installations.Unlock()
+	if lookup != nil && time.Now().Before(lookup.expires) {
+		return lookup.id, nil
+	}
+
+	statCount("github.app_installation")
+	installation := struct {
+		ID int64 `json:"id"`
+	}{}
+	err := githubAppRequest("GET", path+"/installation", &installation)
+	if err != nil && !isNotFound(err) {
+		return 0, err
+	}
+
+	installations.Lock()
+	installations.lookups[path] = &installationLookup{installation.ID, time.Now().Add(installationLookupTTL)}
+	installations.Unlock()
+	return installation.ID, nil
+}
+
+// installationTokenSource caches the token of the installation until it is about to expire
+type installationTokenSource struct {
+	id int64
+}
+
+// Token implements oauth2.TokenSource. The lock is not held while the token is exchanged
+// so that concurrent runs may each exchange a token when it is about to expire
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	installations.Lock()
+	token := installations.tokens[s.id]
+	installations.Unlock()
+	if token != nil && time.Now().Add(installationTokenLeeway).Before(token.Expiry) {
+		return token, nil
+	}
+
+	statCount("github.app_token")
+	result := struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	if err := githubAppRequest("POST", fmt.Sprintf("app/installations/%d/access_tokens", s.id), &result); err != nil {
+		return nil, err
+	}
+	token = &oauth2.Token{AccessToken: result.Token, TokenType: "token", Expiry: result.ExpiresAt}
+	installations.Lock()
+	installations.tokens[s.id] = token
+	installations.Unlock()
+	return token, nil
+}
+
+// conditionalScope implements conditionalScoper since installation tokens are refreshed every hour
+func (s *installationTokenSource) conditionalScope() string {
+	return fmt.Sprintf("installation-%d", s.id)
+}
+
+// installationTransport keeps a rejected installation token from being treated as the user's expired token
+type installationTransport struct {
+	base http.RoundTripper
+	id   int64
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *installationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if isTokenExpired(err) {
+		installations.Lock()
+		delete(installations.tokens, t.id)
+		installations.Unlock()
+		return nil, fmt.Errorf("installation %d: %s", t.id, err)
+	}
+	return resp, err
+}
+
+// githubInstallationClient is shared by all runs since the token is refreshed when needed
+func githubInstallationClient(id int64) *localGithub {
+	installations.Lock()
+	defer installations.Unlock()
+	if client := installations.clients[id]; client != nil {
+		return client
+	}
+	tc := newAPIClient(&installationTokenSource{id}, isRefListing)
+	tc.Transport = &installationTransport{tc.Transport, id}
+	client := newGithubClientFor(tc)
+	installations.clients[id] = client
+	return client
+}
+
+// githubAppClient returns the client for the installation covering the path
+// Fetching fails with githubAppNotInstalled when no installation covers it
+func githubAppClient(path string) GitRemoteIface {
+	id, err := githubInstallation(path)
+	if err != nil {
+		log.Printf("Could not find installation for %s: %s", path, err)
+		return &erroringClient{getGitConfig(GithubProvider), err}
+	}
+	if id == 0 {
+		name := path[strings.Index(path, "/")+1:]
+		return &erroringClient{getGitConfig(GithubProvider), githubAppNotInstalled{name}}
+	}
+	return githubInstallationClient(id)
+}
+
+// erroringClient provides links but fails fetching with err.
+// It lists releases, pull requests and issues like the github client so that err is reported instead of the feature not being supported
+type erroringClient struct {
+	GitRemoteIface
+	err error
+}
+
+func (e *erroringClient) Branches(string) ([]*GitRefWithCommit, error) {
+	return nil, e.err
+}
+
+func (e *erroringClient) Tags(string) ([]*GitRefWithCommit, error) {
+	return nil, e.err
+}
+
+func (e *erroringClient) Releases(string) ([]*GitRelease, error) {
+	return nil, e.err
+}
+
+func (e *erroringClient) PullRequests(string, time.Time) ([]*GitPullRequest, error) {
+	return nil, e.err
+}
+
+func (e *erroringClient) Issues(string, time.Time) ([]*GitIssue, error) {
+	return nil, e.err
+}
+
+func (e *erroringClient) ReposForUser(string) ([]*searchRepoItem, error) {
+	return nil, e.err
+}
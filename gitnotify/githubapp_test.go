@@ -0,0 +1,87 @@
+package gitnotify
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGithubAppInstallationTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(saved *rsa.PrivateKey) { githubAppKey = saved }(githubAppKey)
+	restoreConfig(t)
+	githubAppKey = key
+	config.GithubAppID = 1234
+
+	exchanges := 0
+	newFakeServer(t, &config.GithubAPIEndPoint, "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/repos/acme/widgets/installation", "/app/installations/42/access_tokens":
+			jwt := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+			signature, _ := base64.RawURLEncoding.DecodeString(jwt[len(jwt)-1])
+			sum := sha256.Sum256([]byte(jwt[0] + "." + jwt[1]))
+			if len(jwt) != 3 || rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], signature) != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Path == "/repos/acme/widgets/installation" {
+				w.Write([]byte(`{"id": 42}`))
+				return
+			}
+			exchanges++
+			fmt.Fprintf(w, `{"token": "installation-token", "expires_at": "%s"}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+		case "/repos/acme/widgets/branches":
+			if !strings.HasSuffix(auth, " installation-token") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`[{"name": "master", "commit": {"sha": "abc"}}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	user := &Authentication{Provider: GithubProvider, Token: "user-token"}
+	for i := 0; i < 2; i++ {
+		client := getGitClientForRepo(&Repo{Repo: "acme/widgets", Provider: GithubProvider}, user)
+		branches, err := client.Branches("acme/widgets")
+		if err != nil || len(branches) != 1 || branches[0].Commit != "abc" {
+			t.Fatalf("expected branches fetched as the installation, got %v %v", branches, err)
+		}
+	}
+	if exchanges != 1 {
+		t.Errorf("expected the installation token to be reused, exchanged %d times", exchanges)
+	}
+
+	client := getGitClientForRepo(&Repo{Repo: "acme/other", Provider: GithubProvider}, user)
+	if _, err := client.Branches("acme/other"); err == nil || !strings.Contains(err.Error(), "not installed") {
+		t.Errorf("expected repository without installation to fail, got %v", err)
+	}
+}
+
+func TestErroringClientReportsItsError(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", Provider: GithubProvider, Releases: true, PullRequests: true, Issues: true}
+	client := &erroringClient{getGitConfig(GithubProvider), githubAppNotInstalled{"acme"}}
+	info := storedInfo()
+	last := time.Now().UTC()
+	info["acme/widgets"].Repo.PullRequestsSince = &last
+	info["acme/widgets"].Repo.IssuesSince = &last
+
+	diff, _ := processRepoDiff(client, repo, info)
+	for _, feature := range []string{gitRefRelease, gitPullRequest, gitIssue} {
+		if !strings.Contains(diff.FetchErrors[feature], "not installed") {
+			t.Errorf("expected %s to fail with the missing installation, got %q", feature, diff.FetchErrors[feature])
+		}
+	}
+}
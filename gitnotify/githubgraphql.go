@@ -0,0 +1,201 @@
+package gitnotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+/*
+Refs of many repositories are fetched with a single GraphQL query. Every
+repository and ref type is requested under its own alias. Example:
+  query {
+    q0: repository(owner: "sairam", name: "gitnotify") {
+      refs(refPrefix: "refs/heads/", first: 100) {
+        pageInfo { hasNextPage endCursor }
+        nodes { name target { oid ... on Tag { target { oid } } } }
+      }
+    }
+  }
+*/
+
+// number of aliases in a single query. github limits the number of nodes per query to 500,000
+const githubGraphQLBatchSize = 25
+
+// number of refs requested per alias. maximum allowed is 100
+const githubGraphQLPageSize = 100
+
+// repositories with more pages of refs are fetched over REST
+const githubGraphQLMaxPages = 100
+
+// repoRefs are the branches and tags of a repository fetched in a batch
+// nil means the ref type was not fetched
+type repoRefs struct {
+	Branches []*GitRefWithCommit
+	Tags     []*GitRefWithCommit
+}
+
+// refBatchItem is a page of branches or tags of a repository that is yet to be fetched
+type refBatchItem struct {
+	repo    string
+	refType string
+	cursor  string
+	page    int
+}
+
+type githubGraphQLRefs struct {
+	PageInfo struct {
+		HasNextPage bool   `json:"hasNextPage"`
+		EndCursor   string `json:"endCursor"`
+	} `json:"pageInfo"`
+	Nodes []struct {
+		Name   string `json:"name"`
+		Target struct {
+			OID    string `json:"oid"`
+			Target *struct {
+				OID string `json:"oid"`
+			} `json:"target"` // annotated tags point to the commit through the tag object
+		} `json:"target"`
+	} `json:"nodes"`
+}
+
+type githubGraphQLRepository struct {
+	Refs *githubGraphQLRefs `json:"refs"`
+}
+
+type githubGraphQLResponse struct {
+	Data   map[string]*githubGraphQLRepository `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// BatchRefs fetches the branches and tags for all repos that need them.
+// Repositories that could not be fetched are not part of the result so that they can be fetched over REST
+func (g *localGithub) BatchRefs(repos []*Repo) (map[string]*repoRefs, error) {
+	if config.GithubGraphQLEndPoint == "" {
+		return nil, nil
+	}
+	statCount("github.batch_refs")
+
+	result := make(map[string]*repoRefs)
+	var pending []*refBatchItem
+	for _, repo := range repos {
+		refs := &repoRefs{}
+		if repo.Branches || len(repo.NamedReferences) > 0 {
+			refs.Branches = make([]*GitRefWithCommit, 0, githubGraphQLPageSize)
+			pending = append(pending, &refBatchItem{repo: repo.Repo, refType: gitRefBranch})
+		}
+		if repo.Tags {
+			refs.Tags = make([]*GitRefWithCommit, 0, githubGraphQLPageSize)
+			pending = append(pending, &refBatchItem{repo: repo.Repo, refType: gitRefTag})
+		}
+		result[repo.Repo] = refs
+	}
+
+	failed := make(map[string]bool)
+	for len(pending) > 0 {
+		batch := pending
+		if len(batch) > githubGraphQLBatchSize {
+			batch = pending[:githubGraphQLBatchSize]
+		}
+		pending = pending[len(batch):]
+
+		data, err := g.queryRefs(batch)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, item := range batch {
+			repository := data[fmt.Sprintf("q%d", i)]
+			if failed[item.repo] {
+				continue
+			}
+			if repository == nil || repository.Refs == nil {
+				failed[item.repo] = true
+				continue
+			}
+			refs := repository.Refs
+			for _, node := range refs.Nodes {
+				ref := &GitRefWithCommit{Name: node.Name, Commit: node.Target.OID}
+				if node.Target.Target != nil {
+					ref.Commit = node.Target.Target.OID
+				}
+				if item.refType == gitRefBranch {
+					result[item.repo].Branches = append(result[item.repo].Branches, ref)
+				} else {
+					result[item.repo].Tags = append(result[item.repo].Tags, ref)
+				}
+			}
+			if !refs.PageInfo.HasNextPage {
+				continue
+			}
+			if item.page+1 >= githubGraphQLMaxPages {
+				log.Printf("Stopped fetching %s of %s after %d pages\n", item.refType, item.repo, githubGraphQLMaxPages)
+				failed[item.repo] = true
+				continue
+			}
+			pending = append(pending, &refBatchItem{item.repo, item.refType, refs.PageInfo.EndCursor, item.page + 1})
+		}
+	}
+
+	for repo := range failed {
+		delete(result, repo)
+	}
+	return result, nil
+}
+
+// queryRefs requests a page of refs for each item aliased as q0, q1 ..
+func (g *localGithub) queryRefs(items []*refBatchItem) (map[string]*githubGraphQLRepository, error) {
+	var query bytes.Buffer
+	query.WriteString("query {\n")
+	for i, item := range items {
+		ownerRepo := strings.SplitN(item.repo, "/", 2)
+		if len(ownerRepo) != 2 {
+			ownerRepo = append(ownerRepo, "")
+		}
+		prefix := "refs/heads/"
+		if item.refType == gitRefTag {
+			prefix = "refs/tags/"
+		}
+		after := ""
+		if item.cursor != "" {
+			after = ", after: " + graphQLString(item.cursor)
+		}
+		fmt.Fprintf(&query, "q%d: repository(owner: %s, name: %s) {\n", i, graphQLString(ownerRepo[0]), graphQLString(ownerRepo[1]))
+		fmt.Fprintf(&query, "refs(refPrefix: %s, first: %d%s) {\n", graphQLString(prefix), githubGraphQLPageSize, after)
+		query.WriteString("pageInfo { hasNextPage endCursor }\n")
+		query.WriteString("nodes { name target { oid ... on Tag { target { oid } } } }\n")
+		query.WriteString("}\n}\n")
+	}
+	query.WriteString("}")
+
+	req, err := g.Client().NewRequest("POST", config.GithubGraphQLEndPoint, map[string]string{"query": query.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &githubGraphQLResponse{}
+	start := time.Now()
+	_, err = g.Client().Do(context.TODO(), req, response)
+	statValue("github.api_time", time.Since(start).Nanoseconds()/1000)
+	statCount("github.api_call")
+	if err != nil {
+		return nil, err
+	}
+	// errors are returned along with partial data when a repository is not found
+	if response.Data == nil && len(response.Errors) > 0 {
+		return nil, fmt.Errorf("github graphql: %s", response.Errors[0].Message)
+	}
+	return response.Data, nil
+}
+
+// graphQLString quotes s as a GraphQL string literal. JSON strings are valid GraphQL strings
+func graphQLString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
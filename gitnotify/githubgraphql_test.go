@@ -0,0 +1,101 @@
+package gitnotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var graphQLAliasPattern = regexp.MustCompile(`(q\d+): repository\(owner: "(.*?)", name: "(.*?)"\) \{\nrefs\(refPrefix: "refs/(heads|tags)/", first: (\d+)(?:, after: "(.*?)")?\)`)
+
+// newFakeGithubGraphQL serves branchCount branches and a single annotated tag for acme/widgets
+// every other repository is not found
+func newFakeGithubGraphQL(t *testing.T, branchCount int, queries *int) {
+	ts := newFakeServer(t, &config.GithubAPIEndPoint, "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*queries++
+		body := struct {
+			Query string `json:"query"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		data := make(map[string]interface{})
+		for _, m := range graphQLAliasPattern.FindAllStringSubmatch(body.Query, -1) {
+			if m[2]+"/"+m[3] != "acme/widgets" {
+				data[m[1]] = nil
+				continue
+			}
+			var nodes []interface{}
+			hasNext := false
+			if m[4] == "heads" {
+				first, _ := strconv.Atoi(m[5])
+				start, _ := strconv.Atoi(m[6])
+				for i := start; i < start+first && i < branchCount; i++ {
+					nodes = append(nodes, map[string]interface{}{
+						"name":   fmt.Sprintf("branch-%03d", i),
+						"target": map[string]string{"oid": fmt.Sprintf("%040d", i)},
+					})
+				}
+				hasNext = start+first < branchCount
+				m[6] = strconv.Itoa(start + first)
+			} else {
+				nodes = append(nodes, map[string]interface{}{
+					"name":   "v1.0.0",
+					"target": map[string]interface{}{"oid": "tagobject", "target": map[string]string{"oid": "tagcommit"}},
+				})
+			}
+			data[m[1]] = map[string]interface{}{"refs": map[string]interface{}{
+				"pageInfo": map[string]interface{}{"hasNextPage": hasNext, "endCursor": m[6]},
+				"nodes":    nodes,
+			}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	config.GithubGraphQLEndPoint = ts.URL + "/graphql"
+}
+
+func TestGithubBatchRefs(t *testing.T) {
+	queries := 0
+	newFakeGithubGraphQL(t, 150, &queries)
+
+	repos := []*Repo{
+		{Repo: "acme/widgets", Branches: true, Tags: true},
+		{Repo: "acme/missing", Branches: true},
+	}
+	refs, err := newGithubClient("token").BatchRefs(repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queries != 2 {
+		t.Errorf("expected 2 queries for 3 ref lists across 2 pages, got %d", queries)
+	}
+	if refs["acme/missing"] != nil {
+		t.Error("repository that was not found should be fetched over REST")
+	}
+
+	widgets := refs["acme/widgets"]
+	if widgets == nil || len(widgets.Branches) != 150 || widgets.Branches[149].Name != "branch-149" {
+		t.Fatalf("expected 150 branches, got %v", widgets)
+	}
+	if len(widgets.Tags) != 1 || widgets.Tags[0].Commit != "tagcommit" {
+		t.Errorf("expected annotated tag to point to the commit, got %v", widgets.Tags)
+	}
+}
+
+func TestGithubBatchRefsTooManyPages(t *testing.T) {
+	queries := 0
+	newFakeGithubGraphQL(t, githubGraphQLMaxPages*githubGraphQLPageSize+1, &queries)
+
+	refs, err := newGithubClient("token").BatchRefs([]*Repo{{Repo: "acme/widgets", Branches: true, Tags: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queries != githubGraphQLMaxPages {
+		t.Errorf("expected %d queries, got %d", githubGraphQLMaxPages, queries)
+	}
+	if refs["acme/widgets"] != nil {
+		t.Error("repository with a partial list of branches should be fetched over REST")
+	}
+}
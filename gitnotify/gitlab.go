@@ -3,13 +3,17 @@ package gitnotify
 import (
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
-	gitlabApp "github.com/xanzy/go-gitlab"
+	"golang.org/x/oauth2"
 )
 
 /*
-Example:
+API v4. Projects are addressed with their numeric id or the url encoded path. Example:
   [{
     "name":"master",
     "commit":{
@@ -44,60 +48,381 @@ func (*localGitlab) CompareLink(repo, oldCommit, newCommit string) string {
 	return fmt.Sprintf(gitlabCompareURLEndPoint, repo, oldCommit, newCommit)
 }
 
-func (g *localGitlab) Client() *gitlabApp.Client {
-	return g.client.(*gitlabApp.Client)
+func (g *localGitlab) Client() *http.Client {
+	return g.client.(*http.Client)
 }
 
 func newGitlabClient(token string) *localGitlab {
 	if token == "" {
 		return &localGitlab{}
 	}
-	git := gitlabApp.NewOAuthClient(nil, token)
-	git.SetBaseURL(strings.TrimRight(config.GitlabAPIEndPoint, "/"))
-	return &localGitlab{git}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	return &localGitlab{newAPIClient(ts, isRefListing)}
 }
 
-// repoID can be integer or user/repo format
+// repoID can be integer or group/subgroup/repo format
 func (g *localGitlab) DefaultBranch(repoID string) (string, error) {
-	p, _, err := g.Client().Projects.GetProject(repoID)
-	return p.DefaultBranch, err
+	statCount("gitlab.default_branch")
+	project := &gitlabProject{}
+	if _, err := g.get(g.projectPath(repoID), project); err != nil {
+		return "", err
+	}
+	return project.DefaultBranch, nil
 }
 
-func (g *localGitlab) Tags(repoID string) ([]*GitRefWithCommit, error) {
-	listBranches, _, err := g.Client().Tags.ListTags(repoID)
+// internal projects are visible only to logged in users and are treated as private
+func (g *localGitlab) IsPrivate(repoID string) (bool, error) {
+	statCount("gitlab.is_private")
+	project := &gitlabProject{}
+	if _, err := g.get(g.projectPath(repoID), project); err != nil {
+		return false, err
+	}
+	return project.Visibility != "public", nil
+}
+
+// ProjectID resolves the numeric id of the project. The id does not change when the project is renamed or moved
+func (g *localGitlab) ProjectID(repoName string) (string, error) {
+	statCount("gitlab.project_id")
+	project := &gitlabProject{}
+	if _, err := g.get(g.projectPath(repoName), project); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(project.ID), nil
+}
+
+// projectPath encodes the namespaced path since gitlab expects acme%2Fplatform%2Fapi as the project id
+func (g *localGitlab) projectPath(repoID string) string {
+	return "projects/" + url.PathEscape(repoID)
+}
+
+type gitlabRef struct {
+	Name   string `json:"name"`
+	Commit struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+}
+
+type gitlabTooManyPages struct {
+	path string
+}
+
+func (e gitlabTooManyPages) Error() string {
+	return fmt.Sprintf("gitlab: more than %d pages for %s", config.gitlabMaxPages(), e.path)
+}
+
+// get requests path relative to gitlabAPIEndPoint and decodes the json response into v
+func (g *localGitlab) get(path string, v interface{}) (http.Header, error) {
+	return getJSONWithHeader(g.Client(), GitlabProvider, config.GitlabAPIEndPoint+path, v)
+}
+
+// paginate follows the X-Next-Page header until the last page.
+// fetch decodes the page and returns the response headers
+func (g *localGitlab) paginate(path string, query url.Values, fetch func(pagePath string) (http.Header, error)) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("per_page", strconv.Itoa(config.gitlabPageSize()))
+	page := "1"
+	for i := 0; i < config.gitlabMaxPages(); i++ {
+		query.Set("page", page)
+		header, err := fetch(path + "?" + query.Encode())
+		if err != nil {
+			return err
+		}
+		page = header.Get("X-Next-Page")
+		if page == "" {
+			return nil
+		}
+	}
+	log.Printf("Stopped fetching %s after %d pages\n", path, config.gitlabMaxPages())
+	return gitlabTooManyPages{path}
+}
+
+// refs lists all branches or tags of a repository across pages
+func (g *localGitlab) refs(repoID, refType string) ([]*GitRefWithCommit, error) {
+	refs := make([]*GitRefWithCommit, 0, config.gitlabPageSize())
+	path := g.projectPath(repoID) + "/repository/" + refType
+	err := g.paginate(path, nil, func(pagePath string) (http.Header, error) {
+		var list []*gitlabRef
+		header, err := g.get(pagePath, &list)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range list {
+			refs = append(refs, &GitRefWithCommit{Name: r.Name, Commit: r.Commit.ID})
+		}
+		return header, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	branches := make([]*GitRefWithCommit, 0, len(listBranches))
-	for _, b := range listBranches {
-		t := &GitRefWithCommit{
-			Name:   b.Name,
-			Commit: b.Commit.ID,
+	return refs, nil
+}
+
+func (g *localGitlab) Tags(repoID string) ([]*GitRefWithCommit, error) {
+	statCount("gitlab.tags")
+	return g.refs(repoID, "tags")
+}
+
+func (g *localGitlab) Branches(repoID string) ([]*GitRefWithCommit, error) {
+	statCount("gitlab.branches")
+	return g.refs(repoID, "branches")
+}
+
+type gitlabRelease struct {
+	Name            string `json:"name"`
+	TagName         string `json:"tag_name"`
+	Description     string `json:"description"`
+	UpcomingRelease bool   `json:"upcoming_release"`
+	Links           struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+}
+
+// Releases returns the latest page of releases, newest first. Releases are identified by their tag.
+// gitlab does not have pre-releases, releases scheduled for the future are treated as one
+func (g *localGitlab) Releases(repoID string) ([]*GitRelease, error) {
+	statCount("gitlab.releases")
+	var list []*gitlabRelease
+	query := url.Values{"per_page": {strconv.Itoa(config.gitlabPageSize())}}
+	if _, err := g.get(g.projectPath(repoID)+"/releases?"+query.Encode(), &list); err != nil {
+		return nil, err
+	}
+
+	releases := make([]*GitRelease, 0, len(list))
+	for _, r := range list {
+		releases = append(releases, &GitRelease{
+			ID:         r.TagName,
+			Name:       r.Name,
+			Tag:        r.TagName,
+			Prerelease: r.UpcomingRelease,
+			Body:       r.Description,
+			URL:        r.Links.Self,
+		})
+	}
+	return releases, nil
+}
+
+type gitlabMergeRequest struct {
+	IID          int      `json:"iid"`
+	Title        string   `json:"title"`
+	Labels       []string `json:"labels"`
+	TargetBranch string   `json:"target_branch"`
+	WebURL       string   `json:"web_url"`
+	Author       struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	MergedAt  *time.Time `json:"merged_at"`
+	ClosedAt  *time.Time `json:"closed_at"`
+}
+
+// PullRequests returns the merge requests updated after since
+func (g *localGitlab) PullRequests(repoID string, since time.Time) ([]*GitPullRequest, error) {
+	statCount("gitlab.merge_requests")
+	var pulls []*GitPullRequest
+	query := url.Values{
+		"state":         {"all"},
+		"order_by":      {"updated_at"},
+		"updated_after": {since.UTC().Format(time.RFC3339)},
+	}
+	err := g.paginate(g.projectPath(repoID)+"/merge_requests", query, func(pagePath string) (http.Header, error) {
+		var list []*gitlabMergeRequest
+		header, err := g.get(pagePath, &list)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range list {
+			pull := &GitPullRequest{
+				Number:    m.IID,
+				Title:     m.Title,
+				Author:    m.Author.Username,
+				Base:      m.TargetBranch,
+				Labels:    m.Labels,
+				URL:       m.WebURL,
+				CreatedAt: m.CreatedAt,
+				UpdatedAt: m.UpdatedAt,
+			}
+			if m.MergedAt != nil {
+				pull.MergedAt = *m.MergedAt
+			}
+			if m.ClosedAt != nil {
+				pull.ClosedAt = *m.ClosedAt
+			}
+			pulls = append(pulls, pull)
 		}
-		branches = append(branches, t)
+		return header, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return branches, nil
+	return pulls, nil
 }
 
-func (g *localGitlab) Branches(repoID string) ([]*GitRefWithCommit, error) {
+type gitlabIssue struct {
+	IID    int      `json:"iid"`
+	Title  string   `json:"title"`
+	Labels []string `json:"labels"`
+	State  string   `json:"state"`
+	WebURL string   `json:"web_url"`
+	Author struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
 
-	listBranches, _, err := g.Client().Branches.ListBranches(repoID, g.firstPageOpts())
+// Issues returns the issues created after since, newest first. The opened state is named open like github
+func (g *localGitlab) Issues(repoID string, since time.Time) ([]*GitIssue, error) {
+	statCount("gitlab.issues")
+	var issues []*GitIssue
+	query := url.Values{
+		"state":         {"all"},
+		"order_by":      {"updated_at"},
+		"sort":          {"desc"},
+		"updated_after": {since.UTC().Format(time.RFC3339)},
+	}
+	err := g.paginate(g.projectPath(repoID)+"/issues", query, func(pagePath string) (http.Header, error) {
+		var list []*gitlabIssue
+		header, err := g.get(pagePath, &list)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range list {
+			state := i.State
+			if state == "opened" {
+				state = "open"
+			}
+			issues = append(issues, &GitIssue{
+				Number:    i.IID,
+				Title:     i.Title,
+				Author:    i.Author.Username,
+				Labels:    i.Labels,
+				State:     state,
+				URL:       i.WebURL,
+				CreatedAt: i.CreatedAt,
+				UpdatedAt: i.UpdatedAt,
+			})
+		}
+		return header, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	branches := make([]*GitRefWithCommit, 0, len(listBranches))
-	for _, b := range listBranches {
-		t := &GitRefWithCommit{
-			Name:   b.Name,
-			Commit: b.Commit.ID,
+	return issues, nil
+}
+
+type gitlabCompare struct {
+	Commits []struct {
+		ID           string    `json:"id"`
+		Message      string    `json:"message"`
+		AuthorName   string    `json:"author_name"`
+		AuthoredDate time.Time `json:"authored_date"`
+	} `json:"commits"`
+	Diffs []struct {
+		OldPath   string `json:"old_path"`
+		NewPath   string `json:"new_path"`
+		Diff      string `json:"diff"`
+		TooLarge  bool   `json:"too_large"`
+		Collapsed bool   `json:"collapsed"`
+	} `json:"diffs"`
+	CompareTimeout bool `json:"compare_timeout"`
+}
+
+// gitlab does not return the number of lines changed, they are counted from the unified diff.
+// Only the lines before the first hunk are headers, changed lines can start with --- or +++ as well
+func countDiffLines(diff string) (additions, deletions int) {
+	inHunk := false
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			inHunk = true
+			continue
+		}
+		if !inHunk {
+			continue
+		}
+		if strings.HasPrefix(line, "+") {
+			additions++
+		} else if strings.HasPrefix(line, "-") {
+			deletions++
 		}
-		branches = append(branches, t)
 	}
-	return branches, nil
+	return additions, deletions
+}
+
+// Compare lists all commits and changed files between the merge base and the new commit
+func (g *localGitlab) Compare(repoID, oldCommit, newCommit string) (*gitComparison, error) {
+	statCount("gitlab.compare")
+	compare := &gitlabCompare{}
+	query := url.Values{"from": {oldCommit}, "to": {newCommit}}
+	if _, err := g.get(g.projectPath(repoID)+"/repository/compare?"+query.Encode(), compare); err != nil {
+		return nil, err
+	}
+
+	result := &gitComparison{TotalCommits: len(compare.Commits)}
+	if err := g.compareStatus(repoID, oldCommit, newCommit, result); err != nil {
+		return nil, err
+	}
+	for _, c := range compare.Commits {
+		result.Commits = append(result.Commits, &GitCommit{
+			SHA:     c.ID,
+			Author:  c.AuthorName,
+			Date:    c.AuthoredDate,
+			Message: c.Message,
+		})
+	}
+	// large diffs are collapsed and the files may be left out when the comparison times out
+	result.FilesLeftOut = compare.CompareTimeout
+	for _, d := range compare.Diffs {
+		additions, deletions := countDiffLines(d.Diff)
+		file := &GitFileChange{Path: d.NewPath, Additions: additions, Deletions: deletions}
+		if d.OldPath != d.NewPath {
+			file.PreviousPath = d.OldPath
+		}
+		result.Files = append(result.Files, file)
+		result.FilesLeftOut = result.FilesLeftOut || d.TooLarge || d.Collapsed
+	}
+	return result, nil
+}
+
+// compareStatus sets the status like github. The old commit is an ancestor of the new commit when it is the merge base,
+// otherwise the commits dropped are listed by comparing in the reverse direction
+func (g *localGitlab) compareStatus(repoID, oldCommit, newCommit string, result *gitComparison) error {
+	if oldCommit == newCommit {
+		result.Status = "identical"
+		return nil
+	}
+	statCount("gitlab.merge_base")
+	mergeBase := &struct {
+		ID string `json:"id"`
+	}{}
+	query := url.Values{"refs[]": {oldCommit, newCommit}}
+	if _, err := g.get(g.projectPath(repoID)+"/repository/merge_base?"+query.Encode(), mergeBase); err != nil {
+		return err
+	}
+	switch {
+	case mergeBase.ID == oldCommit:
+		result.Status = "ahead"
+		return nil
+	case mergeBase.ID == newCommit:
+		result.Status = "behind"
+	default:
+		result.Status = "diverged"
+	}
+
+	dropped := &gitlabCompare{}
+	query = url.Values{"from": {newCommit}, "to": {oldCommit}}
+	if _, err := g.get(g.projectPath(repoID)+"/repository/compare?"+query.Encode(), dropped); err != nil {
+		return err
+	}
+	result.BehindBy = len(dropped.Commits)
+	return nil
 }
 
 func (g *localGitlab) BranchesWithoutRefs(repoID string) ([]string, error) {
-	listBranches, _, err := g.Client().Branches.ListBranches(repoID, g.firstPageOpts())
+	statCount("gitlab.branches_without_refs")
+	listBranches, err := g.Branches(repoID)
 	if err != nil {
 		return nil, err
 	}
@@ -109,45 +434,163 @@ func (g *localGitlab) BranchesWithoutRefs(repoID string) ([]string, error) {
 	return branches, nil
 }
 
+// SearchRepos matches the query against the path including the namespace like acme/platform/ap
 // Project.Description contains links as well
 func (g *localGitlab) SearchRepos(search string) ([]*searchRepoItem, error) {
-	opt := &gitlabApp.ListProjectsOptions{Search: gitlabApp.String(search)}
-	projects, _, err := g.Client().Projects.ListProjects(opt)
-	if err != nil {
-		log.Print(err)
+	statCount("gitlab.search_repos")
+	query := url.Values{
+		"search":            {strings.TrimSpace(search)},
+		"search_namespaces": {"true"},
+		"simple":            {"true"},
+		"order_by":          {"last_activity_at"},
+	}
+	var projects []*gitlabProject
+	if _, err := g.get("projects?"+query.Encode(), &projects); err != nil {
 		return nil, err
 	}
 
 	t := make([]*searchRepoItem, 0, len(projects))
 	for _, p := range projects {
-		item := &searchRepoItem{}
-		t = append(t, item)
-		item.ID = string(p.ID)
-		item.Name = p.PathWithNamespace
-		item.Description = p.Description
+		t = append(t, &searchRepoItem{
+			ID:          strconv.Itoa(p.ID),
+			Name:        p.PathWithNamespace,
+			Description: p.Description,
+		})
 	}
 	return t, nil
 }
 
-func (g *localGitlab) SearchUsers(_ string) ([]*searchUserItem, error) {
-	return []*searchUserItem{}, &providerNotPresent{GitlabProvider}
+type gitlabNamespace struct {
+	ID       int    `json:"id"`
+	Path     string `json:"path"`
+	FullPath string `json:"full_path"`
+	Kind     string `json:"kind"`
+}
+
+type gitlabProject struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	Description       string `json:"description"`
+	DefaultBranch     string `json:"default_branch"`
+	Visibility        string `json:"visibility"`
+}
+
+// SearchUsers searches both users and groups
+func (g *localGitlab) SearchUsers(query string) ([]*searchUserItem, error) {
+	statCount("gitlab.search_users")
+	var namespaces []*gitlabNamespace
+	if _, err := g.get("namespaces?search="+url.QueryEscape(query), &namespaces); err != nil {
+		return []*searchUserItem{}, err
+	}
+
+	searchResults := make([]*searchUserItem, 0, len(namespaces))
+	for _, n := range namespaces {
+		searchResults = append(searchResults, &searchUserItem{
+			ID:    strconv.Itoa(n.ID),
+			Login: n.FullPath,
+			Type:  strings.Title(n.Kind),
+		})
+	}
+	return searchResults, nil
 }
 
-// provided not supported
-func (g *localGitlab) RemoteOrgType(_ string) (string, error) {
-	return "", &providerNotPresent{GitlabProvider}
+// RemoteOrgType returns Group for groups and subgroups (acme/platform) or User
+func (g *localGitlab) RemoteOrgType(name string) (string, error) {
+	statCount("gitlab.remote_org_type")
+	group := &gitlabNamespace{}
+	_, err := g.get("groups/"+url.PathEscape(name), group)
+	if err == nil {
+		return "Group", nil
+	}
+	if !isNotFound(err) {
+		return "", err
+	}
+
+	var users []*gitlabNamespace
+	if _, err := g.get("users?username="+url.QueryEscape(name), &users); err != nil {
+		return "", err
+	}
+	if len(users) == 0 {
+		return "", &remoteError{GitlabProvider, http.StatusNotFound, "users?username=" + name}
+	}
+	return "User", nil
 }
 
-func (g *localGitlab) ReposForUser(_ string) ([]*searchRepoItem, error) {
-	return []*searchRepoItem{}, &providerNotPresent{GitlabProvider}
+// ReposForUser lists projects of a user or of a group along with its subgroups.
+// Names are relative to the group so that organisation/name is the full path
+func (g *localGitlab) ReposForUser(namespace string) ([]*searchRepoItem, error) {
+	statCount("gitlab.repos_for_user")
+	orgType, err := g.RemoteOrgType(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var projects []*gitlabProject
+	if orgType == "Group" {
+		projects, err = g.groupProjects(namespace, 0)
+	} else {
+		projects, err = g.projects("users/" + url.PathEscape(namespace) + "/projects")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	repoList := make([]*searchRepoItem, 0, len(projects))
+	for _, p := range projects {
+		name := strings.TrimPrefix(p.PathWithNamespace, namespace+"/")
+		repoList = append(repoList, &searchRepoItem{
+			ID:          strconv.Itoa(p.ID),
+			Name:        name,
+			Description: p.Description,
+			Private:     p.Visibility != "public",
+		})
+	}
+	return repoList, nil
 }
 
-func (g *localGitlab) firstPageOpts() *gitlabApp.ListBranchesOptions {
-	return &gitlabApp.ListBranchesOptions{
-		ListOptions: gitlabApp.ListOptions{
-			Page:    1,
-			PerPage: 10,
-		},
+// gitlab allows subgroups to be nested 20 levels deep
+const gitlabMaxGroupDepth = 20
+
+// groupProjects lists projects of the group and recursively of its subgroups
+func (g *localGitlab) groupProjects(group string, depth int) ([]*gitlabProject, error) {
+	projects, err := g.projects("groups/" + url.PathEscape(group) + "/projects")
+	if err != nil || depth >= gitlabMaxGroupDepth {
+		return projects, err
+	}
+
+	var subgroups []*gitlabNamespace
+	err = g.paginate("groups/"+url.PathEscape(group)+"/subgroups", nil, func(pagePath string) (http.Header, error) {
+		var list []*gitlabNamespace
+		header, err := g.get(pagePath, &list)
+		subgroups = append(subgroups, list...)
+		return header, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, subgroup := range subgroups {
+		subProjects, err := g.groupProjects(subgroup.FullPath, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, subProjects...)
 	}
+	return projects, nil
+}
 
+func (g *localGitlab) projects(path string) ([]*gitlabProject, error) {
+	var projects []*gitlabProject
+	query := url.Values{"order_by": {"created_at"}, "sort": {"asc"}}
+	err := g.paginate(path, query, func(pagePath string) (http.Header, error) {
+		var list []*gitlabProject
+		header, err := g.get(pagePath, &list)
+		projects = append(projects, list...)
+		return header, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return projects, nil
 }
@@ -0,0 +1,191 @@
+package gitnotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newFakeGitlab paginates refCount branches and tags the same way gitlab does
+func newFakeGitlab(t *testing.T, refCount int) {
+	refs := func(prefix string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+			list := make([]*gitlabRef, 0, perPage)
+			for i := (page - 1) * perPage; i < page*perPage && i < refCount; i++ {
+				ref := &gitlabRef{Name: fmt.Sprintf("%s-%03d", prefix, i)}
+				ref.Commit.ID = fmt.Sprintf("%040d", i)
+				list = append(list, ref)
+			}
+			if page*perPage < refCount {
+				w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+			}
+			json.NewEncoder(w).Encode(list)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/acme%2Fwidgets/repository/branches", refs("branch"))
+	mux.HandleFunc("/api/v4/projects/acme%2Fwidgets/repository/tags", refs("v"))
+	addFakeGitlabGroups(mux)
+	newFakeServer(t, &config.GitlabAPIEndPoint, "/api/v4/", mux)
+}
+
+func TestGitlabRefsPaginate(t *testing.T) {
+	newFakeGitlab(t, 350)
+	config.GitlabPageSize = 20
+
+	client := newGitlabClient("token")
+	branches, err := client.Branches("acme/widgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 350 || branches[349].Name != "branch-349" {
+		t.Errorf("expected 350 branches, got %d", len(branches))
+	}
+
+	tags, err := client.Tags("acme/widgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 350 || tags[0].Commit != fmt.Sprintf("%040d", 0) {
+		t.Errorf("expected 350 tags, got %d", len(tags))
+	}
+}
+
+func TestGitlabRefsStopAtMaxPages(t *testing.T) {
+	newFakeGitlab(t, 500)
+	config.GitlabPageSize = 10
+	config.GitlabMaxPages = 5
+
+	branches, err := newGitlabClient("token").Branches("acme/widgets")
+	if _, ok := err.(gitlabTooManyPages); !ok {
+		t.Errorf("expected gitlabTooManyPages, got %v", err)
+	}
+	if branches != nil {
+		t.Errorf("partial list of branches should not be returned, got %d", len(branches))
+	}
+}
+
+// addFakeGitlabGroups serves the group acme with the nested subgroups acme/platform/infra and the user jdoe
+func addFakeGitlabGroups(mux *http.ServeMux) {
+	groups := map[string][]string{
+		"acme":                {"acme/platform"},
+		"acme/platform":       {"acme/platform/infra"},
+		"acme/platform/infra": {},
+	}
+	projects := map[string][]*gitlabProject{
+		"groups/acme":                {{ID: 1, PathWithNamespace: "acme/widgets"}},
+		"groups/acme/platform":       {{ID: 2, PathWithNamespace: "acme/platform/api"}},
+		"groups/acme/platform/infra": {{ID: 3, PathWithNamespace: "acme/platform/infra/terraform"}},
+		"users/jdoe":                 {{ID: 4, PathWithNamespace: "jdoe/dotfiles"}},
+	}
+	mux.HandleFunc("/api/v4/", func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/v4/")
+		parts := strings.Split(path, "/")
+		name, _ := url.PathUnescape(parts[len(parts)-1])
+		if len(parts) == 3 {
+			name, _ = url.PathUnescape(parts[1])
+		}
+		switch {
+		case path == "users":
+			var users []*gitlabNamespace
+			if r.URL.Query().Get("username") == "jdoe" {
+				users = append(users, &gitlabNamespace{ID: 10, Path: "jdoe", Kind: "user"})
+			}
+			json.NewEncoder(w).Encode(users)
+		case path == "projects":
+			json.NewEncoder(w).Encode([]*gitlabProject{{ID: 278964, PathWithNamespace: "acme/platform/api"}})
+		case path == "namespaces":
+			json.NewEncoder(w).Encode([]*gitlabNamespace{{ID: 20, Path: "platform", FullPath: "acme/platform", Kind: "group"}})
+		case len(parts) == 2 && parts[0] == "projects" && name == "acme/platform/api":
+			json.NewEncoder(w).Encode(&gitlabProject{ID: 2, PathWithNamespace: name, DefaultBranch: "main"})
+		case len(parts) == 2 && parts[0] == "groups" && groups[name] != nil:
+			json.NewEncoder(w).Encode(&gitlabNamespace{FullPath: name, Kind: "group"})
+		case len(parts) == 3 && parts[2] == "subgroups":
+			var subgroups []*gitlabNamespace
+			for _, g := range groups[name] {
+				subgroups = append(subgroups, &gitlabNamespace{FullPath: g, Kind: "group"})
+			}
+			json.NewEncoder(w).Encode(subgroups)
+		case len(parts) == 3 && parts[2] == "projects":
+			json.NewEncoder(w).Encode(projects[parts[0]+"/"+name])
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func TestGitlabReposForGroupIncludesSubgroups(t *testing.T) {
+	newFakeGitlab(t, 0)
+
+	repos, err := newGitlabClient("token").ReposForUser("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range repos {
+		names = append(names, r.Name)
+	}
+	expected := []string{"widgets", "platform/api", "platform/infra/terraform"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestGitlabRemoteOrgType(t *testing.T) {
+	newFakeGitlab(t, 0)
+
+	client := newGitlabClient("token")
+	for name, expected := range map[string]string{"acme": "Group", "acme/platform": "Group", "jdoe": "User", "nobody": ""} {
+		orgType, _ := client.RemoteOrgType(name)
+		if orgType != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, orgType)
+		}
+	}
+
+	repos, err := client.ReposForUser("jdoe")
+	if err != nil || len(repos) != 1 || repos[0].Name != "dotfiles" {
+		t.Errorf("expected the projects of jdoe, got %v (%v)", repos, err)
+	}
+
+	users, err := client.SearchUsers("plat")
+	if err != nil || len(users) != 1 || users[0].Login != "acme/platform" || users[0].Type != "Group" {
+		t.Errorf("unexpected namespace search result %v (%v)", users, err)
+	}
+}
+
+func TestGitlabNestedProjectPath(t *testing.T) {
+	newFakeGitlab(t, 0)
+
+	if repo := validateRepoName(GitlabProvider, "acme/platform/api"); repo != "acme/platform/api" {
+		t.Errorf("nested repository name was rejected, got %q", repo)
+	}
+	if repo := validateRepoName(GithubProvider, "acme/platform/api"); repo != "" {
+		t.Errorf("nested repository names are only valid for gitlab, got %q", repo)
+	}
+	branch, err := newGitlabClient("token").DefaultBranch("acme/platform/api")
+	if err != nil || branch != "main" {
+		t.Errorf("expected main, got %q (%v)", branch, err)
+	}
+}
+
+func TestGitlabProjectIDs(t *testing.T) {
+	newFakeGitlab(t, 0)
+
+	client := newGitlabClient("token")
+	repos, err := client.SearchRepos("acme/platform/ap")
+	if err != nil || len(repos) != 1 || repos[0].ID != "278964" {
+		t.Errorf("expected the numeric project id, got %v (%v)", repos, err)
+	}
+
+	repo := &Repo{Repo: "acme/platform/api", Provider: GitlabProvider}
+	resolveRepoID(client, repo)
+	if repo.ID != "2" || repo.remoteName() != "2" {
+		t.Errorf("expected project id 2 to be resolved, got %q", repo.ID)
+	}
+}
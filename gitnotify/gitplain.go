@@ -0,0 +1,476 @@
+package gitnotify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// localGitPlain talks to any git server without an API by reading the refs advertised
+// for git-upload-pack, the same information `git ls-remote` prints.
+// Repositories are identified by their clone url. Supported schemes are
+//
+//	http(s):// - smart http, falls back to dumb http (info/refs)
+//	git://     - git daemon
+//	file://    - local repositories, only when gitAllowFileURLs is set
+//
+// Hosts can be restricted with gitAllowedHosts. Hosts that are not listed cannot resolve
+// to loopback or private addresses, so that urls cannot be used to reach internal services
+type localGitPlain struct{}
+
+const (
+	gitRefHeadsPrefix = "refs/heads/"
+	gitRefTagsPrefix  = "refs/tags/"
+	gitPeeledSuffix   = "^{}"
+	gitDaemonPort     = "9418"
+	gitRemoteTimeout  = 30 * time.Second
+)
+
+// GitLinkTemplates are used to build links for repositories tracked by their git url
+// Placeholders: {url} clone url, {host}, {path} path without the .git suffix,
+// {ref} branch/tag/commit, {old} and {new} commits while comparing
+type GitLinkTemplates struct {
+	Repo    string `yaml:"repo"`    // "https://{host}/{path}"
+	Tree    string `yaml:"tree"`    // "https://{host}/{path}/tree/?h={ref}"
+	Commit  string `yaml:"commit"`  // "https://{host}/{path}/log/?h={ref}"
+	Compare string `yaml:"compare"` // "https://{host}/{path}/diff/?id={new}&id2={old}"
+}
+
+// networks that git urls can reach only when their host is in gitAllowedHosts
+var gitPrivateNetworks = parseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range gitPrivateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return ip == nil
+}
+
+type gitHostNotAllowed struct {
+	host string
+}
+
+func (e gitHostNotAllowed) Error() string {
+	return fmt.Sprintf("git: %s is not an allowed host", e.host)
+}
+
+func isGitHostListed(host string) bool {
+	return contains(config.GitAllowedHosts, strings.ToLower(host))
+}
+
+// gitHostAllowed is true for the hosts in gitAllowedHosts. Any host is allowed when the list is empty
+func gitHostAllowed(host string) bool {
+	return len(config.GitAllowedHosts) == 0 || isGitHostListed(host)
+}
+
+// gitDial connects to the allowed hosts. Hosts that are not listed can connect only to public addresses.
+// The address is checked after it is resolved, so that redirects and dns cannot point to internal services
+func gitDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !gitHostAllowed(host) {
+		return nil, gitHostNotAllowed{host}
+	}
+	dialer := &net.Dialer{Timeout: gitRemoteTimeout}
+	if !isGitHostListed(host) {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			ip, _, err := net.SplitHostPort(address)
+			if err != nil || isPrivateIP(net.ParseIP(ip)) {
+				return gitHostNotAllowed{host}
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+func isPlainGitURL(repo string) bool {
+	for _, scheme := range []string{"http://", "https://", "git://", "file://"} {
+		if strings.HasPrefix(repo, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkTemplates looks up templates by host and falls back to "*"
+func (*localGitPlain) linkTemplates(repo string) (*GitLinkTemplates, *url.URL) {
+	u, err := url.Parse(repo)
+	if err != nil {
+		return &GitLinkTemplates{}, &url.URL{}
+	}
+	if t := config.GitLinkTemplates[u.Host]; t != nil {
+		return t, u
+	}
+	if t := config.GitLinkTemplates["*"]; t != nil {
+		return t, u
+	}
+	return &GitLinkTemplates{}, u
+}
+
+func (g *localGitPlain) link(template, repo, ref, oldCommit, newCommit string) string {
+	if template == "" {
+		return repo
+	}
+	_, u := g.linkTemplates(repo)
+	path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	return strings.NewReplacer(
+		"{url}", repo,
+		"{host}", u.Host,
+		"{path}", path,
+		"{ref}", url.QueryEscape(ref),
+		"{old}", oldCommit,
+		"{new}", newCommit,
+	).Replace(template)
+}
+
+// Helpers
+
+func (*localGitPlain) WebsiteLink() string {
+	return ""
+}
+
+func (g *localGitPlain) RepoLink(repo string) string {
+	t, _ := g.linkTemplates(repo)
+	return g.link(t.Repo, repo, "", "", "")
+}
+
+func (g *localGitPlain) TreeLink(repo, ref string) string {
+	t, _ := g.linkTemplates(repo)
+	return g.link(t.Tree, repo, ref, "", "")
+}
+
+func (g *localGitPlain) CommitLink(repo, ref string) string {
+	t, _ := g.linkTemplates(repo)
+	return g.link(t.Commit, repo, ref, "", "")
+}
+
+func (g *localGitPlain) CompareLink(repo, oldCommit, newCommit string) string {
+	t, _ := g.linkTemplates(repo)
+	return g.link(t.Compare, repo, "", oldCommit, newCommit)
+}
+
+func newGitPlainClient() *localGitPlain {
+	return &localGitPlain{}
+}
+
+// gitAdvertisement is the parsed list of refs advertised by the remote
+type gitAdvertisement struct {
+	refs   []*GitRefWithCommit // in the order advertised, peeled tags are merged in
+	symref string              // branch HEAD points to, empty when unknown
+	head   string              // commit of HEAD
+}
+
+// lsRemote fetches the refs from the remote using the scheme of the repo url
+func (g *localGitPlain) lsRemote(repo string) (*gitAdvertisement, error) {
+	statCount("git.ls_remote")
+	u, err := url.Parse(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	defer func() { statValue("git.api_time", time.Since(start).Nanoseconds()/1000) }()
+
+	switch u.Scheme {
+	case "http", "https":
+		return g.lsRemoteHTTP(u)
+	case "git":
+		return g.lsRemoteDaemon(u)
+	case "file":
+		if !config.GitAllowFileURLs {
+			return nil, errors.New("file:// urls are not allowed")
+		}
+		return g.lsRemoteFile(u)
+	}
+	return nil, &providerNotPresent{GitProvider + "+" + u.Scheme}
+}
+
+func (g *localGitPlain) lsRemoteHTTP(u *url.URL) (*gitAdvertisement, error) {
+	base := strings.TrimSuffix(u.String(), "/")
+	client := &http.Client{Timeout: gitRemoteTimeout, Transport: &http.Transport{DialContext: gitDial}}
+
+	resp, err := client.Get(base + "/info/refs?service=git-upload-pack")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, &remoteError{GitProvider, resp.StatusCode, base}
+	}
+
+	if resp.Header.Get("Content-Type") == "application/x-git-upload-pack-advertisement" {
+		return parseGitAdvertisement(resp.Body, true)
+	}
+
+	// dumb http server. info/refs does not contain HEAD, it is read separately
+	adv, err := parseGitInfoRefs(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	headResp, err := client.Get(base + "/HEAD")
+	if err != nil {
+		return adv, nil
+	}
+	defer headResp.Body.Close()
+	head, _ := ioutil.ReadAll(io.LimitReader(headResp.Body, 1024))
+	if headResp.StatusCode < 400 && bytes.HasPrefix(head, []byte("ref: ")) {
+		adv.symref = strings.TrimPrefix(strings.TrimSpace(string(head[5:])), gitRefHeadsPrefix)
+	}
+	return adv, nil
+}
+
+func (g *localGitPlain) lsRemoteDaemon(u *url.URL) (*gitAdvertisement, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), gitDaemonPort)
+	}
+	conn, err := gitDial(context.Background(), "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(gitRemoteTimeout))
+
+	request := fmt.Sprintf("git-upload-pack %s\x00host=%s\x00", u.Path, u.Hostname())
+	if _, err := conn.Write(pktLine(request)); err != nil {
+		return nil, err
+	}
+	adv, err := parseGitAdvertisement(conn, false)
+	// tell the daemon that we do not want anything
+	conn.Write([]byte("0000"))
+	return adv, err
+}
+
+func (g *localGitPlain) lsRemoteFile(u *url.URL) (*gitAdvertisement, error) {
+	out, err := exec.Command("git", "upload-pack", "--advertise-refs", u.Path).Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseGitAdvertisement(bytes.NewReader(out), false)
+}
+
+func pktLine(data string) []byte {
+	return []byte(fmt.Sprintf("%04x%s", len(data)+4, data))
+}
+
+// readPktLine returns the payload of the next pkt-line. flush packets return nil
+func readPktLine(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	length, err := strconv.ParseUint(string(size[:]), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkt-line length %q", size)
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	if length < 4 {
+		return nil, fmt.Errorf("invalid pkt-line length %q", size)
+	}
+	data := make([]byte, length-4)
+	_, err = io.ReadFull(r, data)
+	return data, err
+}
+
+// parseGitAdvertisement reads the ref advertisement of git-upload-pack
+//
+//	[# service=git-upload-pack\n 0000]   only for smart http
+//	<sha> <ref>\0<capabilities>\n
+//	<sha> <ref>\n
+//	0000
+func parseGitAdvertisement(r io.Reader, smartHTTP bool) (*gitAdvertisement, error) {
+	if smartHTTP {
+		line, err := readPktLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(line, []byte("# service=")) {
+			return nil, errors.New("invalid smart http response")
+		}
+		if _, err := readPktLine(r); err != nil {
+			return nil, err
+		}
+	}
+
+	adv := &gitAdvertisement{}
+	first := true
+	for {
+		line, err := readPktLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			break
+		}
+		line = bytes.TrimRight(line, "\n")
+		if bytes.HasPrefix(line, []byte("ERR ")) {
+			return nil, errors.New(string(line[4:]))
+		}
+		if first {
+			first = false
+			if i := bytes.IndexByte(line, 0); i >= 0 {
+				adv.parseCapabilities(string(line[i+1:]))
+				line = line[:i]
+			}
+		}
+		adv.add(string(line))
+	}
+	return adv, nil
+}
+
+// parseGitInfoRefs reads info/refs served by dumb http servers
+//
+//	<sha>\t<ref>\n
+func parseGitInfoRefs(r io.Reader) (*gitAdvertisement, error) {
+	adv := &gitAdvertisement{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		adv.add(strings.Replace(scanner.Text(), "\t", " ", 1))
+	}
+	return adv, scanner.Err()
+}
+
+func (a *gitAdvertisement) parseCapabilities(capabilities string) {
+	for _, c := range strings.Fields(capabilities) {
+		if strings.HasPrefix(c, "symref=HEAD:") {
+			a.symref = strings.TrimPrefix(strings.TrimPrefix(c, "symref=HEAD:"), gitRefHeadsPrefix)
+		}
+	}
+}
+
+// add a "<sha> <ref>" line. Peeled tags replace the commit of the tag that was seen before
+func (a *gitAdvertisement) add(line string) {
+	shaRef := strings.SplitN(line, " ", 2)
+	if len(shaRef) != 2 {
+		return
+	}
+	sha, name := shaRef[0], shaRef[1]
+	if name == "HEAD" {
+		a.head = sha
+		return
+	}
+	if strings.HasSuffix(name, gitPeeledSuffix) {
+		name = strings.TrimSuffix(name, gitPeeledSuffix)
+		for _, ref := range a.refs {
+			if ref.Name == name {
+				ref.Commit = sha
+			}
+		}
+		return
+	}
+	a.refs = append(a.refs, &GitRefWithCommit{Name: name, Commit: sha})
+}
+
+// refsWithPrefix returns the refs with prefix and strips the prefix from the name
+func (a *gitAdvertisement) refsWithPrefix(prefix string) []*GitRefWithCommit {
+	refs := make([]*GitRefWithCommit, 0, len(a.refs))
+	for _, ref := range a.refs {
+		if strings.HasPrefix(ref.Name, prefix) {
+			refs = append(refs, &GitRefWithCommit{Name: strings.TrimPrefix(ref.Name, prefix), Commit: ref.Commit})
+		}
+	}
+	return refs
+}
+
+func (g *localGitPlain) Branches(repo string) ([]*GitRefWithCommit, error) {
+	statCount("git.branches")
+	adv, err := g.lsRemote(repo)
+	if err != nil {
+		return nil, err
+	}
+	return adv.refsWithPrefix(gitRefHeadsPrefix), nil
+}
+
+func (g *localGitPlain) Tags(repo string) ([]*GitRefWithCommit, error) {
+	statCount("git.tags")
+	adv, err := g.lsRemote(repo)
+	if err != nil {
+		return nil, err
+	}
+	return adv.refsWithPrefix(gitRefTagsPrefix), nil
+}
+
+func (g *localGitPlain) BranchesWithoutRefs(repo string) ([]string, error) {
+	statCount("git.branches_without_refs")
+	listBranches, err := g.Branches(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	branches := make([]string, 0, len(listBranches))
+	for _, b := range listBranches {
+		branches = append(branches, b.Name)
+	}
+	return branches, nil
+}
+
+// DefaultBranch is the HEAD symref. Servers not advertising symref fall back to
+// the first branch pointing to the same commit as HEAD
+func (g *localGitPlain) DefaultBranch(repo string) (string, error) {
+	statCount("git.default_branch")
+	adv, err := g.lsRemote(repo)
+	if err != nil {
+		return "", err
+	}
+	if adv.symref != "" {
+		return adv.symref, nil
+	}
+	for _, b := range adv.refsWithPrefix(gitRefHeadsPrefix) {
+		if b.Commit == adv.head {
+			return b.Name, nil
+		}
+	}
+	return "", errors.New("could not find the default branch of " + repo)
+}
+
+// git servers cannot be searched
+
+func (g *localGitPlain) SearchRepos(_ string) ([]*searchRepoItem, error) {
+	return []*searchRepoItem{}, &providerNotPresent{GitProvider}
+}
+
+func (g *localGitPlain) SearchUsers(_ string) ([]*searchUserItem, error) {
+	return []*searchUserItem{}, &providerNotPresent{GitProvider}
+}
+
+func (g *localGitPlain) RemoteOrgType(_ string) (string, error) {
+	return "", &providerNotPresent{GitProvider}
+}
+
+func (g *localGitPlain) ReposForUser(_ string) ([]*searchRepoItem, error) {
+	return []*searchRepoItem{}, &providerNotPresent{GitProvider}
+}
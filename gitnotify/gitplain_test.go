@@ -0,0 +1,98 @@
+package gitnotify
+
+import (
+	"net/http/cgi"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newBareRepo creates a bare repository with a main and a develop branch and an annotated tag
+func newBareRepo(t *testing.T) string {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	bare := filepath.Join(dir, "repo.git")
+	commands := [][]string{
+		{"init", "-q", "-b", "main", work},
+		{"-C", work, "-c", "user.name=gitnotify", "-c", "user.email=hub@gitnotify.com", "commit", "-q", "--allow-empty", "-m", "first"},
+		{"-C", work, "-c", "user.name=gitnotify", "-c", "user.email=hub@gitnotify.com", "tag", "-a", "v1.0.0", "-m", "v1.0.0"},
+		{"-C", work, "branch", "develop"},
+		{"clone", "-q", "--bare", work, bare},
+	}
+	for _, args := range commands {
+		if out, err := exec.Command(git, args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s %s", args, err, out)
+		}
+	}
+	return bare
+}
+
+func TestGitPlainSmartHTTP(t *testing.T) {
+	bare := newBareRepo(t)
+	git, _ := exec.LookPath("git")
+	ts := httptest.NewServer(&cgi.Handler{
+		Path: git,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + filepath.Dir(bare), "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	defer ts.Close()
+
+	repo := ts.URL + "/repo.git"
+	client := newGitPlainClient()
+
+	// loopback addresses are reachable only when the host is listed
+	if _, err := client.Branches(repo); err == nil || !strings.Contains(err.Error(), "not an allowed host") {
+		t.Fatalf("expected the loopback address to be rejected, got %v", err)
+	}
+	restoreConfig(t)
+	config.GitAllowedHosts = []string{"example.com"}
+	if validateGitURL(repo) != "" || validateGitURL("https://example.com/repo.git") == "" {
+		t.Error("expected only the listed hosts to be valid")
+	}
+	config.GitAllowedHosts = []string{"127.0.0.1"}
+
+	branches, err := client.BranchesWithoutRefs(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 2 || !StringIn(branches, "main") || !StringIn(branches, "develop") {
+		t.Errorf("unexpected branches %v", branches)
+	}
+
+	defaultBranch, err := client.DefaultBranch(repo)
+	if err != nil || defaultBranch != "main" {
+		t.Errorf("expected main, got %q (%v)", defaultBranch, err)
+	}
+
+	tags, err := client.Tags(repo)
+	if err != nil || len(tags) != 1 {
+		t.Fatalf("expected 1 tag, got %v (%v)", tags, err)
+	}
+	head, _ := exec.Command(git, "-C", bare, "rev-parse", "main").Output()
+	if tags[0].Name != "v1.0.0" || tags[0].Commit+"\n" != string(head) {
+		t.Errorf("annotated tag should point to the commit, got %v", tags[0])
+	}
+}
+
+func TestGitPlainFileURL(t *testing.T) {
+	bare := newBareRepo(t)
+	client := newGitPlainClient()
+
+	restoreConfig(t)
+	config.GitAllowFileURLs = false
+	if _, err := client.Branches("file://" + bare); err == nil {
+		t.Error("file:// urls should not be allowed by default")
+	}
+
+	config.GitAllowFileURLs = true
+	branches, err := client.Branches("file://" + bare)
+	if err != nil || len(branches) != 2 {
+		t.Errorf("expected 2 branches, got %v (%v)", branches, err)
+	}
+}
@@ -1,8 +1,14 @@
 package gitnotify
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
 )
 
 // This file provides helper functions to have business and view logic in run.go
@@ -40,12 +46,85 @@ func (e providerNotPresent) Error() string {
 	return fmt.Sprintf("Provider [%s] is not supported", e.name)
 }
 
+type featureNotSupported struct {
+	provider string
+	feature  string
+}
+
+func (e featureNotSupported) Error() string {
+	return fmt.Sprintf("%s are not supported for %s", e.feature, e.provider)
+}
+
+// remoteError is returned when a provider responds with a status code >= 400
+type remoteError struct {
+	provider   string
+	StatusCode int
+	URL        string
+}
+
+func (e *remoteError) Error() string {
+	return fmt.Sprintf("%s: %s responded with status code %d", e.provider, e.URL, e.StatusCode)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*remoteError)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// getJSON is used by providers that do not have an api client library
+// the json response is decoded into v
+func getJSON(client *http.Client, provider, u string, v interface{}) error {
+	_, err := getJSONWithHeader(client, provider, u, v)
+	return err
+}
+
+// getJSONWithHeader also returns the response headers which contain pagination details
+func getJSONWithHeader(client *http.Client, provider, u string, v interface{}) (http.Header, error) {
+	start := time.Now()
+	resp, err := client.Get(u)
+	statValue(provider+".api_time", time.Since(start).Nanoseconds()/1000)
+	statCount(provider + ".api_call")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return resp.Header, &remoteError{provider, resp.StatusCode, u}
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(v)
+}
+
 // GitRefWithCommit contains branch or tag name with Commit
 type GitRefWithCommit struct {
 	Name   string
 	Commit string
 }
 
+// GitRelease is a published release. Body is in markdown
+type GitRelease struct {
+	ID         string
+	Name       string
+	Tag        string
+	Prerelease bool
+	Body       string
+	URL        string
+}
+
+// GitPullRequest is a pull request or a merge request. MergedAt and ClosedAt are zero until it is merged or closed
+type GitPullRequest struct {
+	Number    int
+	Title     string
+	Author    string
+	Base      string
+	Labels    []string
+	URL       string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	MergedAt  time.Time
+	ClosedAt  time.Time
+}
+
 func getGitConfig(provider string) GitRemoteIface {
 	return getGitClient(provider, "")
 }
@@ -55,27 +134,73 @@ func getGitClient(provider, token string) GitRemoteIface {
 		return newGithubClient(token)
 	} else if provider == GitlabProvider {
 		return newGitlabClient(token)
+	} else if provider == GiteaProvider {
+		return newGiteaClient(token)
+	} else if provider == BitbucketProvider {
+		return newBitbucketClient(token)
+	} else if provider == GitProvider {
+		return newGitPlainClient()
 	}
 	return &localGitnull{provider}
 }
 
+// repositories tracked by their git url do not use the provider the user logged in with
+// github repositories are fetched as the GitHub App when it is configured
+func getGitClientForRepo(repo *Repo, auth *Authentication) GitRemoteIface {
+	if repo.Provider == GitProvider {
+		return getGitClient(GitProvider, "")
+	}
+	if repo.Provider == GithubProvider && config.isGithubAppSetup() {
+		return githubAppClient("repos/" + repo.Repo)
+	}
+	return getGitClientForUser(auth)
+}
+
+// getGitClientForUser refreshes the token of the user when it expires
+func getGitClientForUser(auth *Authentication) GitRemoteIface {
+	if auth.RefreshToken != "" && auth.Provider == GiteaProvider {
+		return newGiteaClientFor(auth.tokenSource())
+	} else if auth.RefreshToken != "" && auth.Provider == BitbucketProvider {
+		return newBitbucketClientFor(auth.tokenSource())
+	}
+	return getGitClient(auth.Provider, auth.Token)
+}
+
+// getGitClientForProvider uses the user's token unless the repository is tracked by its git url
+func getGitClientForProvider(provider string, auth *Authentication) GitRemoteIface {
+	if provider == GitProvider {
+		return getGitClient(GitProvider, "")
+	}
+	return getGitClientForUser(auth)
+}
+
+func getGitClientForOrg(org *Organisation, auth *Authentication) GitRemoteIface {
+	if auth.Provider == GithubProvider && config.isGithubAppSetup() {
+		if org.Type == "Organization" {
+			return githubAppClient("orgs/" + org.Name)
+		}
+		return githubAppClient("users/" + org.Name)
+	}
+	return getGitClientForUser(auth)
+}
+
 func getBranchTagInfo(client GitRemoteIface, branch *gitBranchList) ([]*GitRefWithCommit, error) {
 	if branch.option == gitRefBranch {
-		return client.Branches(branch.repo.Repo)
+		return client.Branches(branch.repo.remoteName())
 	} else if branch.option == gitRefTag {
-		return client.Tags(branch.repo.Repo)
+		return client.Tags(branch.repo.remoteName())
 	}
 	return nil, errors.New("Operation " + branch.option + " not supported")
 }
 
-func getGitTypeAhead(provider, token, search string) ([]*searchRepoItem, error) {
-	fmt.Println("Search Request:", search, " Provider: ", provider)
-	client := getGitClient(provider, token)
+func getGitTypeAhead(auth *Authentication, search string) ([]*searchRepoItem, error) {
+	fmt.Println("Search Request:", search, " Provider: ", auth.Provider)
+	client := getGitClientForUser(auth)
 	return client.SearchRepos(search)
 }
 
-func getGitBranchInfoForRepo(provider, token, repoName string) (*typeAheadBranchList, error) {
-	client := getGitClient(provider, token)
+func getGitBranchInfoForRepo(provider string, auth *Authentication, repoName string) (*typeAheadBranchList, error) {
+	client := getGitClientForProvider(provider, auth)
 
 	branchCh := make(chan string)
 	branchListCh := make(chan []string)
@@ -107,17 +232,197 @@ func getGitBranchInfoForRepo(provider, token, repoName string) (*typeAheadBranch
 
 }
 
-func validateRemoteRepoName(provider, token, repoName string) bool {
-	client := getGitClient(provider, token)
-	branch, err := client.DefaultBranch(repoName)
-	if err != nil || branch == "" {
-		return false
+var (
+	errRepoNotFound = errors.New("repository not found")
+	errRepoNoAccess = errors.New("no access to repository")
+)
+
+// the visibility of a repository is resolved when it is added and refreshed after this long
+const repoVisibilityTTL = 24 * time.Hour
+
+// repoVisibility is implemented by providers that can tell if a repository is private
+type repoVisibility interface {
+	IsPrivate(repoName string) (bool, error)
+}
+
+// validateRemoteRepoName returns whether the repository is private.
+// errRepoNoAccess is returned when the repository may exist but cannot be read with the token
+func validateRemoteRepoName(provider string, auth *Authentication, repoName string) (bool, error) {
+	client := getGitClientForProvider(provider, auth)
+	visibility, ok := client.(repoVisibility)
+	if !ok {
+		branch, err := client.DefaultBranch(repoName)
+		if err != nil || branch == "" {
+			return false, errRepoNotFound
+		}
+		return false, nil
+	}
+
+	private, err := visibility.IsPrivate(repoName)
+	if e, ok := err.(*remoteError); ok {
+		// github responds with 404 for private repositories when the token does not have access to them
+		if e.StatusCode == http.StatusForbidden || (e.StatusCode == http.StatusNotFound && !auth.canReadPrivateRepos()) {
+			return false, errRepoNoAccess
+		}
+		return false, errRepoNotFound
+	}
+	return private, err
+}
+
+// scopeLister is implemented by providers that report the scopes granted to the token
+type scopeLister interface {
+	Scopes() ([]string, error)
+}
+
+// grantedScopes is empty for providers that do not have scopes
+func grantedScopes(provider, token string) []string {
+	lister, ok := getGitClient(provider, token).(scopeLister)
+	if !ok {
+		return nil
+	}
+	scopes, err := lister.Scopes()
+	if err != nil {
+		log.Printf("Could not fetch scopes for %s: %s", provider, err)
+		return nil
+	}
+	return scopes
+}
+
+// newAPIClient returns an oauth2 client that honours the rate limit of the token
+// and sends conditional requests for urls accepted by match
+func newAPIClient(ts oauth2.TokenSource, match func(*http.Request) bool) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if match != nil {
+		c := &conditionalTransport{base: transport, store: getConditionalStore(), match: match}
+		if s, ok := ts.(conditionalScoper); ok {
+			c.scope = s.conditionalScope()
+		}
+		transport = c
+	}
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: ts,
+			Base:   &tokenCheckTransport{&rateLimitTransport{transport}},
+		},
+	}
+}
+
+// batchRefFetcher is implemented by providers that can fetch refs of many repositories in a single request
+type batchRefFetcher interface {
+	BatchRefs(repos []*Repo) (map[string]*repoRefs, error)
+}
+
+// prefetchedClient serves branches and tags from a batch fetch and falls back to the client otherwise
+type prefetchedClient struct {
+	GitRemoteIface
+	refs *repoRefs
+}
+
+// baseClient is used to check for optional interfaces of the provider
+func baseClient(client GitRemoteIface) GitRemoteIface {
+	if p, ok := client.(*prefetchedClient); ok {
+		return p.GitRemoteIface
+	}
+	return client
+}
+
+func (p *prefetchedClient) Branches(repoName string) ([]*GitRefWithCommit, error) {
+	if p.refs.Branches != nil {
+		return p.refs.Branches, nil
+	}
+	return p.GitRemoteIface.Branches(repoName)
+}
+
+func (p *prefetchedClient) Tags(repoName string) ([]*GitRefWithCommit, error) {
+	if p.refs.Tags != nil {
+		return p.refs.Tags, nil
+	}
+	return p.GitRemoteIface.Tags(repoName)
+}
+
+// prefetchRefs batch fetches refs of the repos of the user's provider when the provider supports it
+// As a GitHub App, repositories are batched per installation
+func prefetchRefs(auth *Authentication, repos []*Repo) map[string]*repoRefs {
+	batches := make(map[GitRemoteIface][]*Repo)
+	user := getGitClientForUser(auth)
+	for _, repo := range repos {
+		if repo.Provider != auth.Provider {
+			continue
+		}
+		client := user
+		if repo.Provider == GithubProvider && config.isGithubAppSetup() {
+			id, err := githubInstallation("repos/" + repo.Repo)
+			if err != nil || id == 0 {
+				continue
+			}
+			client = githubInstallationClient(id)
+		}
+		batches[client] = append(batches[client], repo)
+	}
+
+	allRefs := make(map[string]*repoRefs)
+	for client, repos := range batches {
+		fetcher, ok := client.(batchRefFetcher)
+		if !ok {
+			continue
+		}
+		refs, err := fetcher.BatchRefs(repos)
+		if err != nil {
+			log.Printf("Batch fetch failed for %s/%s, falling back: %s", auth.Provider, auth.UserName, err)
+			continue
+		}
+		for name, r := range refs {
+			allRefs[name] = r
+		}
+	}
+	return allRefs
+}
+
+// repoIDResolver is implemented by providers whose api identifies repositories by a stable id
+type repoIDResolver interface {
+	ProjectID(repoName string) (string, error)
+}
+
+// resolveRepoID sets the id of the repository once when the provider supports it
+func resolveRepoID(client GitRemoteIface, repo *Repo) {
+	resolver, ok := client.(repoIDResolver)
+	if !ok || repo.ID != "" {
+		return
+	}
+	id, err := resolver.ProjectID(repo.Repo)
+	if err != nil {
+		log.Printf("Could not resolve id for %s: %s", repo.Repo, err)
+		return
+	}
+	repo.ID = id
+}
+
+// resolveRepoVisibility refreshes the visibility of the repository once every repoVisibilityTTL
+// since it can be changed after it was added. The stored visibility is kept when it cannot be fetched
+func resolveRepoVisibility(client GitRemoteIface, repo *Repo, info map[string]*Information, now time.Time) {
+	visibility, ok := client.(repoVisibility)
+	if !ok {
+		return
+	}
+	t := info[repo.Repo]
+	if t == nil {
+		info[repo.Repo] = newRepoInformation()
+		t = info[repo.Repo]
+	}
+	if t.Repo.VisibilityCheckedAt != nil && now.Sub(*t.Repo.VisibilityCheckedAt) < repoVisibilityTTL {
+		return
+	}
+	private, err := visibility.IsPrivate(repo.remoteName())
+	if err != nil {
+		log.Printf("Could not resolve visibility for %s: %s", repo.Repo, err)
+		return
 	}
-	return true
+	repo.Private = private
+	t.Repo.VisibilityCheckedAt = &now
 }
 
-func getRemoteOrgType(provider, token, orgName string) (string, bool) {
-	client := getGitClient(provider, token)
+func getRemoteOrgType(auth *Authentication, orgName string) (string, bool) {
+	client := getGitClientForUser(auth)
 	orgType, err := client.RemoteOrgType(orgName)
 	if err != nil || orgType == "" {
 		return "", false
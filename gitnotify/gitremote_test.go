@@ -0,0 +1,23 @@
+package gitnotify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// restoreConfig restores the config once the test is done since tests point it to fake servers
+func restoreConfig(t *testing.T) {
+	saved := *config
+	t.Cleanup(func() { *config = saved })
+}
+
+// newFakeServer serves the api of a provider until the test is done.
+// endPoint is the api end point in the config, set to the url of the server followed by apiPath
+func newFakeServer(t *testing.T, endPoint *string, apiPath string, handler http.Handler) *httptest.Server {
+	restoreConfig(t)
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	*endPoint = ts.URL + apiPath
+	return ts
+}
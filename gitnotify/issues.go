@@ -0,0 +1,102 @@
+package gitnotify
+
+import (
+	"sort"
+	"time"
+)
+
+// Issues opened since the last run are reported when they match the labels and the state of the repo.
+// Issues are listed by update time so that the state and the labels are the latest ones.
+// The cursor is the update time of the newest issue listed. The first run only sets the cursor
+
+// issueLister is implemented by providers with issues
+type issueLister interface {
+	// Issues returns the issues updated after since, newest first
+	Issues(repoName string, since time.Time) ([]*GitIssue, error)
+}
+
+// GitIssue is an issue of a repository. State is open or closed
+type GitIssue struct {
+	Number    int
+	Title     string
+	Author    string
+	Labels    []string
+	State     string
+	URL       string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// issueNote is an issue listed in the repoIssueDiff change type
+type issueNote struct {
+	Number int      `json:"number"`
+	Title  string   `json:"title"`
+	State  string   `json:"state"`
+	Author string   `json:"author"`
+	Labels []string `json:"labels"`
+	Href   string   `json:"href"`
+}
+
+func (i *GitIssue) note() issueNote {
+	return issueNote{
+		Number: i.Number,
+		Title:  i.Title,
+		State:  i.State,
+		Author: i.Author,
+		Labels: i.Labels,
+		Href:   i.URL,
+	}
+}
+
+// matchesIssue is true for issues with one of the labels in the state of the repo.
+// Every issue matches when there are no filters
+func (r *Repo) matchesIssue(i *GitIssue) bool {
+	if r.IssueState != "" && r.IssueState != i.State {
+		return false
+	}
+	if len(r.IssueLabels) == 0 {
+		return true
+	}
+	for _, label := range i.Labels {
+		if contains(r.IssueLabels, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffIssues lists the issues opened after the stored cursor, oldest first
+func diffIssues(client GitRemoteIface, repo *Repo, info map[string]*Information, now time.Time) ([]*GitIssue, error) {
+	lister, ok := baseClient(client).(issueLister)
+	if !ok {
+		return nil, featureNotSupported{repo.Provider, gitIssue}
+	}
+	t := info[repo.Repo]
+	if t == nil {
+		info[repo.Repo] = newRepoInformation()
+		t = info[repo.Repo]
+	}
+
+	var since time.Time
+	var list []*GitIssue
+	err := listSince(&t.Repo.IssuesSince, now, func(s time.Time) (err error) {
+		since = s
+		list, err = lister.Issues(repo.remoteName(), since)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var issues []*GitIssue
+	for _, i := range list {
+		if i.UpdatedAt.After(*t.Repo.IssuesSince) {
+			updated := i.UpdatedAt
+			t.Repo.IssuesSince = &updated
+		}
+		if i.CreatedAt.After(since) && repo.matchesIssue(i) {
+			issues = append(issues, i)
+		}
+	}
+	sort.Slice(issues, func(a, b int) bool { return issues[a].CreatedAt.Before(issues[b].CreatedAt) })
+	return issues, nil
+}
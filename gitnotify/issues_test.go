@@ -0,0 +1,86 @@
+package gitnotify
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestProcessRepoDiffIssues(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", Provider: GithubProvider, Issues: true, IssueLabels: []string{"security", "breaking-change"}, IssueState: "open"}
+	last := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		issues: []*GitIssue{
+			{Number: 9, Labels: []string{"breaking-change"}, State: "open", CreatedAt: last.Add(3 * time.Hour), UpdatedAt: last.Add(3 * time.Hour)},
+			{Number: 8, Labels: []string{"docs"}, State: "open", CreatedAt: last.Add(2 * time.Hour), UpdatedAt: last.Add(2 * time.Hour)},
+			{Number: 7, Labels: []string{"security"}, State: "closed", CreatedAt: last.Add(2 * time.Hour), UpdatedAt: last.Add(2 * time.Hour)},
+			{Number: 6, Labels: []string{"bug", "security"}, State: "open", CreatedAt: last.Add(time.Hour), UpdatedAt: last.Add(time.Hour)},
+			{Number: 5, Labels: []string{"security"}, State: "open", CreatedAt: last.Add(-time.Hour), UpdatedAt: last.Add(-time.Hour)},
+		},
+	}
+	info := storedInfo()
+	info["acme/widgets"].Repo.IssuesSince = &last
+
+	diff, err := processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Issues) != 2 || diff.Issues[0].Number != 6 || diff.Issues[1].Number != 9 {
+		t.Fatalf("expected issues 6 and 9 oldest first, got %v", diff.Issues)
+	}
+	if !info["acme/widgets"].Repo.IssuesSince.Equal(last.Add(3 * time.Hour)) {
+		t.Errorf("expected the cursor to be the newest issue, got %v", info["acme/widgets"].Repo.IssuesSince)
+	}
+
+	conf := &Setting{Auth: &Authentication{Provider: GithubProvider}}
+	data := makeRepoDiffs([]*gitRepoDiffs{diff}, conf)[0].Data[0]
+	if data.ChangeType != "repoIssueDiff" || len(data.Issues) != 2 || data.Issues[1].Labels[0] != "breaking-change" {
+		t.Errorf("unexpected issue section %+v", data)
+	}
+
+	diff, err = processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Issues) != 0 {
+		t.Errorf("issues should be reported once, got %v", diff.Issues)
+	}
+
+	// issues opened before the last run are not reported again when they are updated
+	remote.issues[0].UpdatedAt = last.Add(4 * time.Hour)
+	remote.issues[4].UpdatedAt = last.Add(5 * time.Hour)
+	remote.issues = append([]*GitIssue{{Number: 10, Labels: []string{"security"}, State: "open", CreatedAt: last.Add(5 * time.Hour), UpdatedAt: last.Add(5 * time.Hour)}}, remote.issues...)
+	diff, err = processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Issues) != 1 || diff.Issues[0].Number != 10 {
+		t.Errorf("expected only the issue opened since the last run, got %v", diff.Issues)
+	}
+	if !info["acme/widgets"].Repo.IssuesSince.Equal(last.Add(5 * time.Hour)) {
+		t.Errorf("expected the cursor to be the latest update, got %v", info["acme/widgets"].Repo.IssuesSince)
+	}
+}
+
+func TestGithubIssuesSkipPullRequests(t *testing.T) {
+	newFakeServer(t, &config.GithubAPIEndPoint, "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/widgets/issues" || r.URL.Query().Get("sort") != "updated" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[
+			{"number": 12, "title": "Bump deps", "created_at": "2017-06-03T00:00:00Z", "updated_at": "2017-06-03T00:00:00Z", "pull_request": {"url": "https://api.github.com/repos/acme/widgets/pulls/12"}},
+			{"number": 11, "title": "Token leak", "state": "open", "user": {"login": "jane"}, "labels": [{"name": "security"}], "created_at": "2017-06-02T00:00:00Z", "updated_at": "2017-06-02T00:00:00Z"},
+			{"number": 10, "title": "Old issue", "created_at": "2017-05-01T00:00:00Z", "updated_at": "2017-05-01T00:00:00Z"}
+		]`))
+	}))
+
+	issues, err := newGithubClient("token").Issues("acme/widgets", time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 || issues[0].Number != 11 || issues[0].Author != "jane" || issues[0].Labels[0] != "security" {
+		t.Errorf("expected only issue 11, got %+v", issues)
+	}
+}
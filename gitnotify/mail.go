@@ -50,20 +50,25 @@ func processForMail(diff gnDiffDatum, conf *Setting, fileName string) error {
 		SavedFile:  fileName,
 	}
 
+	loc, _ := time.LoadLocation(conf.User.TimeZoneName)
+	t := time.Now().In(loc)
+	subject := "[GitNotify] New Updates from your Repositories - " + t.Format("02 Jan 2006 | 15 Hrs")
+	sendMail(conf, subject, "changes_mail", mailContent)
+	return nil
+}
+
+// sendMail renders the template and its _text version into the html and plain body
+func sendMail(conf *Setting, subject, templateName string, mailContent *MailContent) {
 	htmlBuffer := &bytes.Buffer{}
-	kinli.DisplayPage(htmlBuffer, "changes_mail", mailContent)
+	kinli.DisplayPage(htmlBuffer, templateName, mailContent)
 	html, _ := ioutil.ReadAll(htmlBuffer)
 
 	textBuffer := &bytes.Buffer{}
-	kinli.DisplayPage(textBuffer, "changes_mail_text", mailContent)
+	kinli.DisplayPage(textBuffer, templateName+"_text", mailContent)
 	text, _ := ioutil.ReadAll(textBuffer)
 	plain := strings.Replace(string(text), "\n\n", "\n", -1)
 	plain = strings.Replace(plain, "\n\n", "\n", -1)
 
-	loc, _ := time.LoadLocation(conf.User.TimeZoneName)
-	t := time.Now().In(loc)
-	subject := "[GitNotify] New Updates from your Repositories - " + t.Format("02 Jan 2006 | 15 Hrs")
-
 	fromEmail := &mail.Address{
 		Name:    config.FromName,
 		Address: config.FromEmail,
@@ -96,5 +101,4 @@ func processForMail(diff gnDiffDatum, conf *Setting, fileName string) error {
 	}
 
 	e.SendEmail()
-	return nil
 }
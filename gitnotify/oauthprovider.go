@@ -0,0 +1,209 @@
+package gitnotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markbates/goth"
+	"golang.org/x/oauth2"
+)
+
+// oauthProvider implements goth.Provider for the OAuth2 providers that
+// goth does not ship with in the version we depend on (gitea, bitbucket server)
+type oauthProvider struct {
+	name      string
+	config    *oauth2.Config
+	fetchUser func(token string, user *goth.User) error
+}
+
+// oauthSession stores data during the auth process
+type oauthSession struct {
+	AuthURL      string
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// newOAuthProvider creates a goth provider for an OAuth2 server that goth does not support.
+// fetchUser fills in the profile of the user with the access token once it is available
+func newOAuthProvider(name, clientKey, secret, callbackURL, authURL, tokenURL string, fetchUser func(string, *goth.User) error, scopes ...string) *oauthProvider {
+	return &oauthProvider{
+		name:      name,
+		fetchUser: fetchUser,
+		config: &oauth2.Config{
+			ClientID:     clientKey,
+			ClientSecret: secret,
+			RedirectURL:  callbackURL,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  authURL,
+				TokenURL: tokenURL,
+			},
+		},
+	}
+}
+
+func (p *oauthProvider) Name() string {
+	return p.name
+}
+
+func (p *oauthProvider) SetName(name string) {
+	p.name = name
+}
+
+func (p *oauthProvider) Debug(bool) {}
+
+func (p *oauthProvider) BeginAuth(state string) (goth.Session, error) {
+	return &oauthSession{
+		AuthURL: p.config.AuthCodeURL(state),
+	}, nil
+}
+
+func (p *oauthProvider) UnmarshalSession(data string) (goth.Session, error) {
+	s := &oauthSession{}
+	err := json.NewDecoder(strings.NewReader(data)).Decode(s)
+	return s, err
+}
+
+func (p *oauthProvider) FetchUser(session goth.Session) (goth.User, error) {
+	sess := session.(*oauthSession)
+	user := goth.User{
+		AccessToken:  sess.AccessToken,
+		Provider:     p.Name(),
+		RefreshToken: sess.RefreshToken,
+		ExpiresAt:    sess.ExpiresAt,
+	}
+
+	if user.AccessToken == "" {
+		return user, fmt.Errorf("%s cannot get user information without accessToken", p.name)
+	}
+
+	err := p.fetchUser(sess.AccessToken, &user)
+	return user, err
+}
+
+func (p *oauthProvider) RefreshTokenAvailable() bool {
+	return true
+}
+
+func (p *oauthProvider) RefreshToken(refreshToken string) (*oauth2.Token, error) {
+	token := &oauth2.Token{RefreshToken: refreshToken}
+	return p.config.TokenSource(oauth2.NoContext, token).Token()
+}
+
+func (s *oauthSession) GetAuthURL() (string, error) {
+	if s.AuthURL == "" {
+		return "", errors.New("an AuthURL has not been set")
+	}
+	return s.AuthURL, nil
+}
+
+func (s *oauthSession) Authorize(provider goth.Provider, params goth.Params) (string, error) {
+	p := provider.(*oauthProvider)
+	token, err := p.config.Exchange(oauth2.NoContext, params.Get("code"))
+	if err != nil {
+		return "", err
+	}
+
+	if !token.Valid() {
+		return "", errors.New("invalid token received from provider")
+	}
+
+	s.AccessToken = token.AccessToken
+	s.RefreshToken = token.RefreshToken
+	s.ExpiresAt = token.Expiry
+	return token.AccessToken, err
+}
+
+func (s *oauthSession) Marshal() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func (s *oauthSession) String() string {
+	return s.Marshal()
+}
+
+// Tokens of the providers using oauthProvider expire. A token source is kept per user so that the
+// token is refreshed once for the cron runs and the web requests. Refreshed tokens are written back to the setting
+
+var userTokens = struct {
+	sync.Mutex
+	sources map[string]*refreshingTokenSource
+}{sources: make(map[string]*refreshingTokenSource)}
+
+// refreshingTokenSource saves the token to the setting file each time it is refreshed
+type refreshingTokenSource struct {
+	sync.Mutex
+	filename string
+	base     oauth2.TokenSource
+	last     string
+}
+
+// Token implements oauth2.TokenSource. A refresh token that is rejected fails with tokenExpired
+func (s *refreshingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if e, ok := err.(*oauth2.RetrieveError); ok && e.Response != nil && e.Response.StatusCode < 500 {
+		return nil, tokenExpired{e.Response.StatusCode}
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Lock()
+	refreshed := token.AccessToken != s.last
+	s.last = token.AccessToken
+	s.Unlock()
+	if refreshed {
+		statCount("auth.token_refreshed")
+		// the lock of the setting may be held by the run using this token
+		go saveRefreshedToken(s.filename, token)
+	}
+	return token, nil
+}
+
+func saveRefreshedToken(filename string, token *oauth2.Token) {
+	defer lockSetting(filename)()
+	conf := new(Setting)
+	if err := conf.load(filename); err != nil || conf.Auth == nil {
+		log.Printf("Could not save refreshed token to %s: %v", filename, err)
+		return
+	}
+	conf.Auth.Token = token.AccessToken
+	conf.Auth.RefreshToken = token.RefreshToken
+	conf.Auth.Expiry = token.Expiry
+	if err := conf.save(filename); err != nil {
+		log.Print(err)
+	}
+}
+
+// tokenSource refreshes the user's token when the provider is an oauthProvider
+func (userInfo *Authentication) tokenSource() oauth2.TokenSource {
+	token := &oauth2.Token{AccessToken: userInfo.Token, RefreshToken: userInfo.RefreshToken, Expiry: userInfo.Expiry}
+	provider, err := goth.GetProvider(userInfo.Provider)
+	p, ok := provider.(*oauthProvider)
+	if err != nil || !ok || userInfo.RefreshToken == "" {
+		return oauth2.StaticTokenSource(token)
+	}
+
+	userTokens.Lock()
+	defer userTokens.Unlock()
+	s := userTokens.sources[userInfo.UserInfo()]
+	if s == nil {
+		s = &refreshingTokenSource{filename: userInfo.getConfigFile(), base: p.config.TokenSource(context.Background(), token), last: token.AccessToken}
+		userTokens.sources[userInfo.UserInfo()] = s
+	}
+	return s
+}
+
+// forgetTokenSource is called when the user logs in again with a new token
+func forgetTokenSource(userInfo *Authentication) {
+	userTokens.Lock()
+	delete(userTokens.sources, userInfo.UserInfo())
+	userTokens.Unlock()
+}
@@ -0,0 +1,62 @@
+package gitnotify
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRefreshingTokenSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "new", "refresh_token": "new-refresh", "expires_in": 3600}`))
+	}))
+	defer ts.Close()
+	oauthConfig := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: ts.URL, AuthStyle: oauth2.AuthStyleInParams}}
+
+	dir, err := ioutil.TempDir("", "gitnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "settings.yml")
+	conf := &Setting{Auth: &Authentication{Provider: GiteaProvider, UserName: "jdoe", Token: "old", RefreshToken: "refresh"}}
+	if err := conf.save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	expired := &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)}
+	s := &refreshingTokenSource{filename: filename, base: oauthConfig.TokenSource(context.Background(), expired), last: "old"}
+	token, err := s.Token()
+	if err != nil || token.AccessToken != "new" {
+		t.Fatalf("expected the token to be refreshed, got %v %v", token, err)
+	}
+	for i := 0; i < 100 && conf.Auth.Token != "new"; i++ {
+		time.Sleep(10 * time.Millisecond)
+		unlock := lockSetting(filename)
+		conf.load(filename)
+		unlock()
+	}
+	if conf.Auth.Token != "new" || conf.Auth.RefreshToken != "new-refresh" || conf.Auth.Expiry.IsZero() {
+		t.Errorf("expected the refreshed token to be saved, got %+v", conf.Auth)
+	}
+
+	expired.RefreshToken = "revoked"
+	s = &refreshingTokenSource{filename: filename, base: oauthConfig.TokenSource(context.Background(), expired), last: "old"}
+	if _, err := s.Token(); !isTokenExpired(err) {
+		t.Errorf("expected a rejected refresh token to expire the token, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package gitnotify
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Tracked branches of a repository with path filters are reported only when a matching file changed.
+// The stored commit is not advanced otherwise, so the next comparison includes the skipped commits.
+// When the files cannot be compared or the provider may have left out some of them, the change is reported as usual
+
+// globPattern converts a glob into a regexp. ** matches across directories, * and ? within a directory
+func globPattern(glob string) *regexp.Regexp {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				re.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				re.WriteString(".*")
+				i++
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
+
+func matchesAnyGlob(globs []string, name string) bool {
+	for _, glob := range globs {
+		if globPattern(glob).MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repo) hasPathFilters() bool {
+	return len(r.IncludePaths) > 0 || len(r.ExcludePaths) > 0
+}
+
+// matchesPath is true for paths that are included and not excluded. Every path is included when there are no include globs
+func (r *Repo) matchesPath(name string) bool {
+	if len(r.IncludePaths) > 0 && !matchesAnyGlob(r.IncludePaths, name) {
+		return false
+	}
+	return !matchesAnyGlob(r.ExcludePaths, name)
+}
+
+// filterPaths sets the matching files of the changed references.
+// References without a matching file are reset to the old commit so that they are not reported or stored
+func filterPaths(repo *Repo, references map[string]*gitCommitDiff) {
+	if !repo.hasPathFilters() {
+		return
+	}
+	for _, commit := range references {
+		if commit.Comparison == nil || commit.Comparison.FilesLeftOut || !commit.changed() {
+			continue
+		}
+		commit.MatchedFiles = nil
+		for _, f := range commit.Comparison.Files {
+			// files renamed out of the filtered paths match with their previous name
+			if repo.matchesPath(f.Path) || (f.PreviousPath != "" && repo.matchesPath(f.PreviousPath)) {
+				commit.MatchedFiles = append(commit.MatchedFiles, f.Path)
+			}
+		}
+		// rewritten history is reported irrespective of the files
+		if len(commit.MatchedFiles) == 0 && !commit.forcePushed() {
+			statCount("run.path_filtered")
+			commit.NewCommit = commit.OldCommit
+			commit.Comparison = nil
+		}
+	}
+}
+
+// parsePathGlobs splits globs separated by commas or whitespace
+func parsePathGlobs(values []string) []string {
+	var globs []string
+	for _, v := range values {
+		for _, glob := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t' }) {
+			globs = append(globs, strings.Trim(glob, "/"))
+		}
+	}
+	return globs
+}
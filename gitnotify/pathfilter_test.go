@@ -0,0 +1,78 @@
+package gitnotify
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGlobPattern(t *testing.T) {
+	tests := []struct {
+		glob, name string
+		match      bool
+	}{
+		{"services/billing/**", "services/billing/api/server.go", true},
+		{"services/billing/**", "services/billing-v2/main.go", false},
+		{"go.mod", "go.mod", true},
+		{"go.mod", "tools/go.mod", false},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/guide/index.md", true},
+		{"*.go", "cmd/main.go", false},
+		{"cmd/?.go", "cmd/a.go", true},
+	}
+	for _, test := range tests {
+		if globPattern(test.glob).MatchString(test.name) != test.match {
+			t.Errorf("%s matching %s should be %v", test.glob, test.name, test.match)
+		}
+	}
+}
+
+func TestProcessRepoDiffPathFilters(t *testing.T) {
+	repo := &Repo{
+		Repo:            "acme/widgets",
+		NamedReferences: []reference{"master"},
+		IncludePaths:    parsePathGlobs([]string{"services/billing/**, go.mod"}),
+		ExcludePaths:    []string{"**/*.md"},
+	}
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		branches:     refs("master"),
+		comparison:   &gitComparison{Files: []*GitFileChange{{Path: "services/billing/README.md"}, {Path: "web/app.js"}}},
+	}
+	info := storedInfo()
+
+	diff, err := processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.References["master"].changed() || info["acme/widgets"].Repo.Commits["master"] != "old-commit" {
+		t.Errorf("commit should not be advanced without matching files, got %v", info["acme/widgets"].Repo.Commits)
+	}
+
+	remote.comparison.Files = append(remote.comparison.Files, &GitFileChange{Path: "go.mod"})
+	diff, err = processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(diff.References["master"].MatchedFiles, []string{"go.mod"}) || info["acme/widgets"].Repo.Commits["master"] != "master-commit" {
+		t.Errorf("expected go.mod to match and the commit to be advanced, got %v", diff.References["master"])
+	}
+}
+
+func TestFilterPathsRenamedAndLeftOutFiles(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", IncludePaths: []string{"services/billing/**"}}
+	renamed := &gitCommitDiff{OldCommit: "a", NewCommit: "b", Comparison: &gitComparison{
+		Files: []*GitFileChange{{Path: "services/payments/api.go", PreviousPath: "services/billing/api.go"}},
+	}}
+	leftOut := &gitCommitDiff{OldCommit: "c", NewCommit: "d", Comparison: &gitComparison{
+		Files:        []*GitFileChange{{Path: "web/app.js"}},
+		FilesLeftOut: true,
+	}}
+	filterPaths(repo, map[string]*gitCommitDiff{"master": renamed, "develop": leftOut})
+
+	if !reflect.DeepEqual(renamed.MatchedFiles, []string{"services/payments/api.go"}) {
+		t.Errorf("expected the file renamed out of the included paths to match, got %v", renamed.MatchedFiles)
+	}
+	if !leftOut.changed() || leftOut.Comparison == nil {
+		t.Errorf("expected the change to be reported when files may be left out, got %v", leftOut)
+	}
+}
@@ -0,0 +1,143 @@
+package gitnotify
+
+import (
+	"strings"
+	"time"
+)
+
+// Pull requests updated since the last run are listed and reported when they were opened, merged or closed.
+// The cursor is the start of the last successful listing. The first run only sets the cursor
+
+// pullRequestLister is implemented by providers with pull requests
+type pullRequestLister interface {
+	// PullRequests returns the pull requests updated after since
+	PullRequests(repoName string, since time.Time) ([]*GitPullRequest, error)
+}
+
+// pullRequestChange is a pull request with its latest activity since the last run
+type pullRequestChange struct {
+	*GitPullRequest
+	Event string // opened, merged or closed
+}
+
+// pullRequestNote is the pull request information sent with the repoPullRequestDiff change type
+type pullRequestNote struct {
+	Number int      `json:"number"`
+	Title  string   `json:"title"`
+	Event  string   `json:"event"`
+	Author string   `json:"author"`
+	Base   string   `json:"base"`
+	Labels []string `json:"labels"`
+}
+
+func (p *pullRequestChange) note() *pullRequestNote {
+	return &pullRequestNote{
+		Number: p.Number,
+		Title:  p.Title,
+		Event:  p.Event,
+		Author: p.Author,
+		Base:   p.Base,
+		Labels: p.Labels,
+	}
+}
+
+// event is the latest activity after since. Empty when the pull request was only updated
+func (p *GitPullRequest) event(since time.Time) string {
+	switch {
+	case p.MergedAt.After(since):
+		return "merged"
+	case p.ClosedAt.After(since):
+		return "closed"
+	case p.CreatedAt.After(since):
+		return "opened"
+	}
+	return ""
+}
+
+// matchesPullRequest is true for pull requests into a matching base branch with one of the labels.
+// Every pull request matches when there are no filters
+func (r *Repo) matchesPullRequest(p *GitPullRequest) bool {
+	if len(r.PullRequestBases) > 0 && !matchesAnyGlob(r.PullRequestBases, p.Base) {
+		return false
+	}
+	if len(r.PullRequestLabels) == 0 {
+		return true
+	}
+	for _, label := range p.Labels {
+		if contains(r.PullRequestLabels, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffPullRequests lists the activity since the stored cursor and advances it to now
+func diffPullRequests(client GitRemoteIface, repo *Repo, info map[string]*Information, now time.Time) ([]*pullRequestChange, error) {
+	lister, ok := baseClient(client).(pullRequestLister)
+	if !ok {
+		return nil, featureNotSupported{repo.Provider, gitPullRequest}
+	}
+	t := info[repo.Repo]
+	if t == nil {
+		info[repo.Repo] = newRepoInformation()
+		t = info[repo.Repo]
+	}
+
+	var since time.Time
+	var pulls []*GitPullRequest
+	err := listSince(&t.Repo.PullRequestsSince, now, func(s time.Time) (err error) {
+		since = s
+		pulls, err = lister.PullRequests(repo.remoteName(), since)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var changes []*pullRequestChange
+	for _, p := range pulls {
+		event := p.event(since)
+		if event == "" || !repo.matchesPullRequest(p) {
+			continue
+		}
+		changes = append(changes, &pullRequestChange{p, event})
+	}
+	t.Repo.PullRequestsSince = &now
+	return changes, nil
+}
+
+// listSince calls list with the time of the cursor. The first run only sets the cursor to now.
+// When the list is cut short by the page limit, the cursor is advanced to now
+// so that the items left out are reported as a failure once instead of failing every run
+func listSince(cursor **time.Time, now time.Time, list func(since time.Time) error) error {
+	if *cursor == nil {
+		*cursor = &now
+		return nil
+	}
+	err := list(**cursor)
+	if isTooManyPages(err) {
+		*cursor = &now
+	}
+	return err
+}
+
+// isTooManyPages is true when the list was cut short by the page limit of the provider
+func isTooManyPages(err error) bool {
+	switch err.(type) {
+	case githubTooManyPages, gitlabTooManyPages:
+		return true
+	}
+	return false
+}
+
+// parseLabels splits labels separated by commas. Labels can have spaces
+func parseLabels(values []string) []string {
+	var labels []string
+	for _, v := range values {
+		for _, label := range strings.Split(v, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
@@ -0,0 +1,106 @@
+package gitnotify
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestProcessRepoDiffPullRequests(t *testing.T) {
+	repo := &Repo{
+		Repo:              "acme/widgets",
+		Provider:          GithubProvider,
+		PullRequests:      true,
+		PullRequestBases:  []string{"main", "release/*"},
+		PullRequestLabels: []string{"bug"},
+	}
+	last := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	before, after := last.Add(-time.Hour), last.Add(time.Hour)
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		pulls: []*GitPullRequest{
+			{Number: 1, Base: "main", Labels: []string{"bug"}, CreatedAt: after, UpdatedAt: after},
+			{Number: 2, Base: "release/1.0", Labels: []string{"docs", "bug"}, CreatedAt: before, UpdatedAt: after, MergedAt: after, ClosedAt: after},
+			{Number: 3, Base: "main", Labels: []string{"bug"}, CreatedAt: before, UpdatedAt: after}, // commented
+			{Number: 4, Base: "feature/x", Labels: []string{"bug"}, CreatedAt: after, UpdatedAt: after},
+			{Number: 5, Base: "main", CreatedAt: before, UpdatedAt: after, ClosedAt: after},
+			{Number: 6, Base: "main", Labels: []string{"bug"}, CreatedAt: before, UpdatedAt: before, ClosedAt: before},
+		},
+	}
+
+	// the first run sets the cursor without reporting existing pull requests
+	info := storedInfo()
+	diff, err := processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.PullRequests) != 0 || info["acme/widgets"].Repo.PullRequestsSince == nil {
+		t.Fatalf("expected only the cursor to be set, got %v", diff.PullRequests)
+	}
+
+	info["acme/widgets"].Repo.PullRequestsSince = &last
+	diff, err = processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.PullRequests) != 2 || diff.PullRequests[0].Event != "opened" || diff.PullRequests[1].Event != "merged" {
+		t.Fatalf("expected #1 opened and #2 merged, got %v", diff.PullRequests)
+	}
+	if !info["acme/widgets"].Repo.PullRequestsSince.After(last) {
+		t.Errorf("expected the cursor to be advanced, got %v", info["acme/widgets"].Repo.PullRequestsSince)
+	}
+
+	conf := &Setting{Auth: &Authentication{Provider: GithubProvider}}
+	data := makeRepoDiffs([]*gitRepoDiffs{diff}, conf)[0].Data[1]
+	if data.ChangeType != "repoPullRequestDiff" || data.Title.Title != "Pull Request Merged: " || data.PullRequest.Base != "release/1.0" {
+		t.Errorf("unexpected pull request entry %+v", data)
+	}
+}
+
+func TestGitlabMergeRequests(t *testing.T) {
+	var updatedAfter string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/42/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		updatedAfter = r.URL.Query().Get("updated_after")
+		w.Write([]byte(`[{"iid": 7, "title": "Fix login", "labels": ["bug"], "target_branch": "main",
+			"web_url": "https://gitlab.com/acme/widgets/merge_requests/7", "author": {"username": "jane"},
+			"created_at": "2017-06-01T10:00:00Z", "updated_at": "2017-06-02T10:00:00Z", "merged_at": "2017-06-02T10:00:00Z", "closed_at": null}]`))
+	})
+	newFakeServer(t, &config.GitlabAPIEndPoint, "/api/v4/", mux)
+
+	since := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	pulls, err := newGitlabClient("token").PullRequests("42", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updatedAfter != "2017-06-01T00:00:00Z" {
+		t.Errorf("expected updated_after to be the cursor, got %s", updatedAfter)
+	}
+	if len(pulls) != 1 || pulls[0].Author != "jane" || pulls[0].event(since) != "merged" || !pulls[0].ClosedAt.IsZero() {
+		t.Errorf("unexpected merge requests %+v", pulls)
+	}
+}
+
+func TestGithubPullRequestsTooManyPages(t *testing.T) {
+	requests := 0
+	newFakeServer(t, &config.GithubAPIEndPoint, "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=%d>; rel="next"`, "http://"+r.Host, r.URL.Path, requests+1))
+		w.Write([]byte(`[{"number": 1, "updated_at": "2017-06-02T10:00:00Z", "created_at": "2017-06-02T10:00:00Z"}]`))
+	}))
+
+	last := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	info := storedInfo()
+	info["acme/widgets"].Repo.PullRequestsSince = &last
+	now := time.Date(2017, 6, 3, 0, 0, 0, 0, time.UTC)
+	repo := &Repo{Repo: "acme/widgets", Provider: GithubProvider, PullRequests: true}
+
+	_, err := diffPullRequests(getGitClient(GithubProvider, "token"), repo, info, now)
+	if _, ok := err.(githubTooManyPages); !ok || requests != githubPullRequestMaxPages {
+		t.Fatalf("expected githubTooManyPages after %d pages, got %v after %d", githubPullRequestMaxPages, err, requests)
+	}
+	if !info["acme/widgets"].Repo.PullRequestsSince.Equal(now) {
+		t.Errorf("expected the cursor to be advanced past the left out activity, got %v", info["acme/widgets"].Repo.PullRequestsSince)
+	}
+}
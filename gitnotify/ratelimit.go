@@ -0,0 +1,141 @@
+package gitnotify
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	githubApp "github.com/google/go-github/github"
+)
+
+// The rate limit of a token is shared by all runs and requests made with it.
+// Requests are not sent once the limit is exhausted. They fail with rateLimited and the run is postponed
+// instead of waiting, since the run holds the lock of the user's setting
+
+// the limit is assumed to reset after this long when the provider does not tell
+const rateLimitDefaultReset = time.Minute
+
+type rateLimited struct {
+	reset time.Time
+}
+
+func (e rateLimited) Error() string {
+	return fmt.Sprintf("rate limit exhausted until %s", e.reset.Format(time.RFC1123))
+}
+
+type rateLimitStatus struct {
+	remaining int
+	reset     time.Time
+}
+
+var rateLimits = struct {
+	sync.Mutex
+	tokens map[string]*rateLimitStatus
+}{tokens: make(map[string]*rateLimitStatus)}
+
+func rateLimitKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// exhaustedUntil returns the time when the limit of the token resets, if it is exhausted
+func exhaustedUntil(key string) (time.Time, bool) {
+	rateLimits.Lock()
+	defer rateLimits.Unlock()
+	status := rateLimits.tokens[key]
+	if status == nil || status.remaining > 0 || time.Now().After(status.reset) {
+		return time.Time{}, false
+	}
+	return status.reset, true
+}
+
+// observeRateLimit reads github's X-RateLimit-* and gitlab's RateLimit-* headers
+func observeRateLimit(key string, resp *http.Response) {
+	header := resp.Header
+	remaining, reset := header.Get("X-RateLimit-Remaining"), header.Get("X-RateLimit-Reset")
+	if remaining == "" {
+		remaining, reset = header.Get("RateLimit-Remaining"), header.Get("RateLimit-Reset")
+	}
+
+	status := &rateLimitStatus{remaining: -1}
+	if r, err := strconv.Atoi(remaining); err == nil {
+		status.remaining = r
+	}
+	if r, err := strconv.ParseInt(reset, 10, 64); err == nil {
+		status.reset = time.Unix(r, 0)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		status.remaining = 0
+		if retry, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+			status.reset = time.Now().Add(time.Duration(retry) * time.Second)
+		}
+	}
+	if status.remaining < 0 {
+		return
+	}
+	if status.reset.IsZero() {
+		status.reset = time.Now().Add(rateLimitDefaultReset)
+	}
+
+	statValue("ratelimit.remaining", int64(status.remaining))
+	rateLimits.Lock()
+	rateLimits.tokens[key] = status
+	rateLimits.Unlock()
+}
+
+// rateLimitTransport governs requests made with the token of the request
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	auth := strings.Fields(req.Header.Get("Authorization"))
+	if len(auth) == 0 {
+		return t.base.RoundTrip(req)
+	}
+	key := rateLimitKey(auth[len(auth)-1])
+
+	if reset, exhausted := exhaustedUntil(key); exhausted {
+		statCount("ratelimit.exhausted")
+		return nil, rateLimited{reset}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	observeRateLimit(key, resp)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		if reset, exhausted := exhaustedUntil(key); exhausted {
+			resp.Body.Close()
+			statCount("ratelimit.exhausted")
+			return nil, rateLimited{reset}
+		}
+	}
+	return resp, nil
+}
+
+// isRateLimited returns the time after which the request can be retried
+func isRateLimited(err error) (time.Time, bool) {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	switch e := err.(type) {
+	case rateLimited:
+		return e.reset, true
+	case *githubApp.RateLimitError:
+		return e.Rate.Reset.Time, true
+	case *githubApp.AbuseRateLimitError:
+		if e.RetryAfter != nil {
+			return time.Now().Add(*e.RetryAfter), true
+		}
+		return time.Now().Add(rateLimitDefaultReset), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,88 @@
+package gitnotify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/sairam/cron.v2"
+)
+
+func TestRateLimitExhausted(t *testing.T) {
+	requests := 0
+	reset := time.Now().Add(time.Hour).Unix()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	client := newAPIClient(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "exhausted-token"}), nil)
+	var list []*gitlabRef
+	if err := getJSON(client, GitlabProvider, ts.URL+"/branches", &list); err != nil {
+		t.Fatal(err)
+	}
+
+	err := getJSON(client, GitlabProvider, ts.URL+"/branches", &list)
+	until, limited := isRateLimited(err)
+	if !limited || until.Unix() != reset {
+		t.Errorf("expected the request to be rate limited until %d, got %v", reset, err)
+	}
+	if requests != 1 {
+		t.Errorf("requests should not be sent once the limit is exhausted, sent %d", requests)
+	}
+
+	other := newAPIClient(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "other-token"}), nil)
+	if err := getJSON(other, GitlabProvider, ts.URL+"/branches", &list); err != nil {
+		t.Errorf("limits should be tracked per token, got %v", err)
+	}
+}
+
+func TestRateLimitExhaustedShortlyDoesNotWait(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second).Unix()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Remaining", "0")
+		w.Header().Set("RateLimit-Reset", strconv.FormatInt(reset, 10))
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	client := newAPIClient(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "shortly-exhausted-token"}), nil)
+	var list []*gitlabRef
+	if err := getJSON(client, GitlabProvider, ts.URL+"/branches", &list); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := getJSON(client, GitlabProvider, ts.URL+"/branches", &list)
+	if _, limited := isRateLimited(err); !limited || time.Since(start) > time.Second {
+		t.Errorf("expected the request to fail without waiting for the reset, got %v after %s", err, time.Since(start))
+	}
+}
+
+func TestStopCronStopsPostponedRun(t *testing.T) {
+	crons = cron.New()
+	filename := "/tmp/gitnotify-postponed.yml"
+	cronJob{filename, false}.postpone(time.Now().Add(time.Hour))
+	if postponedRuns[filename] != nil {
+		t.Fatal("runs that do not save should not be postponed")
+	}
+
+	ran := make(chan bool, 1)
+	postponedRuns[filename] = time.AfterFunc(50*time.Millisecond, func() { ran <- true })
+	cronLocker.Lock()
+	stopCronIfAlreadyRunning(filename)
+	cronLocker.Unlock()
+	if postponedRuns[filename] != nil {
+		t.Error("expected the postponed run to be removed")
+	}
+	select {
+	case <-ran:
+		t.Error("expected the postponed run to be stopped")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,106 @@
+package gitnotify
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// When the provider rejects the user's token, the cron is stopped until the user logs in again.
+// The user is notified once through the configured channels
+
+type tokenExpired struct {
+	status int
+}
+
+func (e tokenExpired) Error() string {
+	return fmt.Sprintf("token was rejected with status %d", e.status)
+}
+
+func isTokenExpired(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	_, ok := err.(tokenExpired)
+	return ok
+}
+
+// tokenRejected is true for a 401 and for a 403 caused by the token.
+// Other 403s are for a single resource like a repository that the user lost access to
+func tokenRejected(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		return strings.Contains(challenge, "invalid_token") || strings.Contains(challenge, "insufficient_scope")
+	}
+	return false
+}
+
+// tokenCheckTransport fails requests with tokenExpired when the token is rejected
+type tokenCheckTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *tokenCheckTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || req.Header.Get("Authorization") == "" || !tokenRejected(resp) {
+		return resp, err
+	}
+	resp.Body.Close()
+	statCount("auth.token_rejected")
+	return nil, tokenExpired{resp.StatusCode}
+}
+
+// requireReauth marks the setting and stops its cron. Notification is sent only the first time
+func requireReauth(filename string) {
+	cronLocker.Lock()
+	stopCronIfAlreadyRunning(filename)
+	cronLocker.Unlock()
+
+	defer lockSetting(filename)()
+	conf := new(Setting)
+	conf.load(filename)
+	if conf.Auth == nil || conf.ReauthRequired {
+		return
+	}
+	log.Printf("Token for %s/%s was rejected. Stopping cron until the user logs in again", conf.Auth.Provider, conf.Auth.UserName)
+	conf.ReauthRequired = true
+	if err := conf.save(filename); err != nil {
+		log.Print(err)
+		return
+	}
+	processForAccessExpired(conf)
+}
+
+func processForAccessExpired(conf *Setting) {
+	statCount("notify.access_expired")
+	loginURL := fmt.Sprintf("%s/auth/%s", config.websiteURL(), conf.Auth.Provider)
+
+	if config.isEmailSetup() && isValidEmail(conf.usersEmail()) {
+		mailContent := &MailContent{
+			WebsiteURL: config.websiteURL(),
+			User:       fmt.Sprintf("%s/%s", conf.Auth.Provider, conf.Auth.UserName),
+			Name:       conf.usersName(),
+		}
+		sendMail(conf, "[GitNotify] Your access has expired", "access_expired_mail", mailContent)
+	}
+
+	// sent in the same format as changes so that existing hooks can process it
+	diffs := gnDiffDatum{&gnDiffData{
+		Repo:    link{"GitNotify", config.websiteURL(), ""},
+		Changed: true,
+		Data: []diffData{{
+			Title:      link{"Login again", loginURL, "Access Expired: "},
+			Error:      fmt.Sprintf("Your access to %s has expired or was revoked. Updates are paused until you login again at %s", conf.Auth.Provider, loginURL),
+			ChangeType: "accessExpired",
+			Changed:    true,
+		}},
+		MadeFor: conf.Auth.UserInfo(),
+	}}
+	processForWebhook(diffs, conf)
+}
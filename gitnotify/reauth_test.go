@@ -0,0 +1,39 @@
+package gitnotify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenRejected(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/revoked":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/scope":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gitlab", error="insufficient_scope"`)
+			w.WriteHeader(http.StatusForbidden)
+		case "/private":
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+
+	client := newAPIClient(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}), nil)
+	for path, expired := range map[string]bool{"/revoked": true, "/scope": true, "/private": false} {
+		var v interface{}
+		err := getJSON(client, GitlabProvider, ts.URL+path, &v)
+		if isTokenExpired(err) != expired {
+			t.Errorf("%s: expected token expired to be %v, got %v", path, expired, err)
+		}
+	}
+
+	repo := &Repo{Repo: "acme/widgets", Tags: true}
+	remote := &fakeRemote{localGitnull: &localGitnull{GithubProvider}, tagErr: tokenExpired{401}}
+	if _, err := processRepoDiff(remote, repo, storedInfo()); !stopsRun(err) {
+		t.Errorf("expected the run to stop when the token is rejected, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package gitnotify
+
+import "sort"
+
+// Refs and repositories are compared as sets since providers do not list them in a stable order
+
+// diffStrings returns the strings only in new and the strings only in old
+func diffStrings(old, new []string) ([]string, []string) {
+	oldSet := make(map[string]bool, len(old))
+	for _, s := range old {
+		oldSet[s] = true
+	}
+	newSet := make(map[string]bool, len(new))
+	for _, s := range new {
+		newSet[s] = true
+	}
+
+	added := make([]string, 0, 1)
+	for s := range newSet {
+		if !oldSet[s] {
+			added = append(added, s)
+		}
+	}
+	removed := make([]string, 0, 1)
+	for s := range oldSet {
+		if !newSet[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+// sortRefs sorts tags by their semantic version followed by tags that are not versions.
+// Everything else is sorted in natural order
+func sortRefs(names []string, option string) {
+	if option != gitRefTag {
+		sort.Slice(names, func(i, j int) bool { return naturalLess(names[i], names[j]) })
+		return
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, aOk := parseSemver(names[i])
+		b, bOk := parseSemver(names[j])
+		switch {
+		case aOk && bOk:
+			if c := a.compare(b); c != 0 {
+				return c < 0
+			}
+		case aOk != bOk:
+			return aOk
+		}
+		return naturalLess(names[i], names[j])
+	})
+}
+
+// naturalLess compares runs of digits by their value so that release-9 is before release-10
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		aDigits, bDigits := isDigit(a[0]), isDigit(b[0])
+		if aDigits != bDigits || !aDigits {
+			if a[0] != b[0] {
+				return a[0] < b[0]
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		i, j := digitsEnd(a), digitsEnd(b)
+		an, bn := trimZeros(a[:i]), trimZeros(b[:j])
+		if len(an) != len(bn) {
+			return len(an) < len(bn)
+		}
+		if an != bn {
+			return an < bn
+		}
+		if i != j {
+			// fewer leading zeros first
+			return i < j
+		}
+		a, b = a[i:], b[j:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func digitsEnd(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+func trimZeros(s string) string {
+	for len(s) > 1 && s[0] == '0' {
+		s = s[1:]
+	}
+	return s
+}
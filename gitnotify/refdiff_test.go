@@ -0,0 +1,72 @@
+package gitnotify
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func shuffled(list []string, seed int64) []string {
+	s := append([]string{}, list...)
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+	return s
+}
+
+func TestDiffStrings(t *testing.T) {
+	tests := []struct {
+		name           string
+		option         string
+		old, new       []string
+		added, removed []string
+	}{
+		{"reordered tags", gitRefTag,
+			[]string{"v1.0.0", "v1.1.0", "v1.10.0", "v1.2.0"},
+			[]string{"v1.10.0", "v1.2.0", "v1.1.0", "v1.0.0"},
+			[]string{}, []string{}},
+		{"new and deleted tags", gitRefTag,
+			[]string{"v1.0.0", "v1.1.0", "nightly"},
+			[]string{"v1.1.0", "v2.0.0", "v1.10.0", "v1.9.0", "v2.0.0-rc.1", "build-10", "build-9"},
+			[]string{"v1.9.0", "v1.10.0", "v2.0.0-rc.1", "v2.0.0", "build-9", "build-10"},
+			[]string{"v1.0.0", "nightly"}},
+		{"new and deleted branches", gitRefBranch,
+			[]string{"master", "release-9", "pr-1"},
+			[]string{"release-10", "master", "release-9", "feature/b", "feature/a", "release-2"},
+			[]string{"feature/a", "feature/b", "release-2", "release-10"},
+			[]string{"pr-1"}},
+		{"first run", gitRefBranch,
+			nil,
+			[]string{"master"},
+			[]string{"master"}, []string{}},
+	}
+	for _, test := range tests {
+		for seed := int64(0); seed < 5; seed++ {
+			added, removed := diffStrings(shuffled(test.old, seed), shuffled(test.new, seed+100))
+			sortRefs(added, test.option)
+			sortRefs(removed, test.option)
+			if !reflect.DeepEqual(added, test.added) || !reflect.DeepEqual(removed, test.removed) {
+				t.Errorf("%s: expected %v %v, got %v %v", test.name, test.added, test.removed, added, removed)
+			}
+		}
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"release-9", "release-10", true},
+		{"release-10", "release-9", false},
+		{"release/1.2", "release/1.10", true},
+		{"develop", "master", true},
+		{"v1", "v01", true},
+		{"main", "main", false},
+		{"main", "main-2", true},
+	}
+	for _, test := range tests {
+		if naturalLess(test.a, test.b) != test.less {
+			t.Errorf("%s < %s should be %v", test.a, test.b, test.less)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package gitnotify
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Releases are tracked by their ids. Only the latest page of releases is fetched and stored
+
+// releaseLister is implemented by providers with releases
+type releaseLister interface {
+	// Releases returns the latest page of releases
+	Releases(repoName string) ([]*GitRelease, error)
+}
+
+// number of characters of the release notes included in notifications
+const releaseExcerptLength = 300
+
+var (
+	markdownCommentPattern = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]+>`)
+	markdownLinkPattern    = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	markdownSyntaxPattern  = regexp.MustCompile("(?m)^\\s*(#+|>|[-*+]\\s)|\\*\\*|__|`")
+)
+
+// releaseNote is the release information sent with the repoReleaseDiff change type
+type releaseNote struct {
+	Name       string `json:"name"`
+	Tag        string `json:"tag"`
+	Prerelease bool   `json:"prerelease"`
+	Excerpt    string `json:"excerpt"`
+}
+
+func (r *GitRelease) displayName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Tag
+}
+
+func (r *GitRelease) note() *releaseNote {
+	return &releaseNote{
+		Name:       r.displayName(),
+		Tag:        r.Tag,
+		Prerelease: r.Prerelease,
+		Excerpt:    releaseExcerpt(r.Body),
+	}
+}
+
+// releaseExcerpt renders the markdown as a single line of text cut at a word
+func releaseExcerpt(body string) string {
+	body = markdownCommentPattern.ReplaceAllString(body, "")
+	body = markdownLinkPattern.ReplaceAllString(body, "$1")
+	body = markdownSyntaxPattern.ReplaceAllString(body, "")
+	text := strings.Join(strings.Fields(body), " ")
+
+	runes := []rune(text)
+	if len(runes) <= releaseExcerptLength {
+		return text
+	}
+	text = string(runes[:releaseExcerptLength])
+	if i := strings.LastIndex(text, " "); i > 0 {
+		text = text[:i]
+	}
+	return text + "..."
+}
+
+// fetchReleases treats an empty list as a failure when releases were found in the last run
+func fetchReleases(client GitRemoteIface, repo *Repo, info map[string]*Information) ([]*GitRelease, error) {
+	lister, ok := baseClient(client).(releaseLister)
+	if !ok {
+		return nil, featureNotSupported{repo.Provider, gitRefRelease}
+	}
+	releases, err := lister.Releases(repo.remoteName())
+	if err != nil || len(releases) > 0 {
+		return releases, err
+	}
+	if t := info[repo.Repo]; t != nil && len(t.Repo.Releases) > 0 {
+		return nil, emptyRefList{gitRefRelease}
+	}
+	return releases, nil
+}
+
+// diffWithOldReleases returns releases that were not present in the last run and stores the ids of the latest releases.
+// When no releases were stored, only the latest release is returned instead of every existing release
+func diffWithOldReleases(releases []*GitRelease, repo *Repo, info map[string]*Information) []*GitRelease {
+	t := info[repo.Repo]
+	if t == nil {
+		info[repo.Repo] = newRepoInformation()
+		t = info[repo.Repo]
+	}
+
+	var newReleases []*GitRelease
+	ids := make([]string, 0, len(releases))
+	for _, r := range releases {
+		if len(t.Repo.Releases) > 0 && !contains(t.Repo.Releases, r.ID) {
+			newReleases = append(newReleases, r)
+		}
+		ids = append(ids, r.ID)
+	}
+	if len(t.Repo.Releases) == 0 && len(releases) > 0 {
+		newReleases = releases[:1]
+	}
+	t.Repo.Releases = ids
+	return newReleases
+}
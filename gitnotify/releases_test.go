@@ -0,0 +1,56 @@
+package gitnotify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReleaseExcerpt(t *testing.T) {
+	body := "<!-- generated -->\n## What's Changed\n* **Fixed** `snake_case` names in [#12](https://example.com/pull/12)\n\n> Thanks!"
+	if excerpt := releaseExcerpt(body); excerpt != "What's Changed Fixed snake_case names in #12 Thanks!" {
+		t.Errorf("unexpected excerpt %q", excerpt)
+	}
+
+	excerpt := releaseExcerpt(strings.Repeat("word ", 100))
+	if len(excerpt) > releaseExcerptLength+3 || !strings.HasSuffix(excerpt, "word...") {
+		t.Errorf("expected excerpt to be cut at a word, got %q", excerpt)
+	}
+}
+
+func TestProcessRepoDiffReleases(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", Releases: true}
+	remote := &fakeRemote{localGitnull: &localGitnull{GithubProvider}, releases: []*GitRelease{
+		{ID: "2", Tag: "v1.1.0", Body: "fixes"},
+		{ID: "1", Name: "First", Tag: "v1.0.0"},
+	}}
+	info := map[string]*Information{}
+
+	diff, err := processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Releases) != 1 || diff.Releases[0].ID != "2" {
+		t.Errorf("expected only the latest release on the first run, got %v", diff.Releases)
+	}
+
+	remote.releases = append([]*GitRelease{{ID: "3", Tag: "v2.0.0-rc1", Prerelease: true}}, remote.releases...)
+	diff, err = processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Releases) != 1 || diff.Releases[0].ID != "3" {
+		t.Fatalf("expected the new release, got %v", diff.Releases)
+	}
+
+	conf := &Setting{Auth: &Authentication{Provider: GithubProvider}}
+	data := makeRepoDiffs([]*gitRepoDiffs{diff}, conf)[0].Data[0]
+	if data.ChangeType != "repoReleaseDiff" || data.Release.Name != "v2.0.0-rc1" || !data.Release.Prerelease {
+		t.Errorf("unexpected release entry %+v", data)
+	}
+
+	remote.releases = nil
+	diff, _ = processRepoDiff(remote, repo, info)
+	if diff.FetchErrors[gitRefRelease] == "" || len(info["acme/widgets"].Repo.Releases) != 3 {
+		t.Errorf("an empty list should not replace stored releases, got %v", diff.FetchErrors)
+	}
+}
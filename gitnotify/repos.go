@@ -12,7 +12,12 @@ import (
 
 // Repository is of the name ^ab-c/d_ef$
 var repoValidator = regexp.MustCompile("^[\\p{L}\\d_-]+/[\\.\\p{L}\\d_-]+$")
-var orgValidator = regexp.MustCompile("^[\\p{L}\\d_-]+$")
+
+// gitlab repositories can be nested in subgroups ^ab-c/d.ef/g_hi$
+var nestedRepoValidator = regexp.MustCompile("^[\\p{L}\\d_-]+(/[\\.\\p{L}\\d_-]+)+$")
+
+// Organisation is of the name ^ab-c$ or a gitlab subgroup ^ab-c/d.ef$
+var orgValidator = regexp.MustCompile("^[\\p{L}\\d_-]+(/[\\.\\p{L}\\d_-]+)*$")
 
 // move to helper file
 func contains(s []string, e string) bool {
@@ -136,6 +141,7 @@ func settingsHandler(w http.ResponseWriter, r *http.Request, formAction string)
 	userInfo := getUserInfo(hc)
 	configFile := userInfo.getConfigFile()
 
+	unlock := lockSetting(configFile)
 	conf := new(Setting)
 	conf.load(configFile)
 
@@ -151,6 +157,7 @@ func settingsHandler(w http.ResponseWriter, r *http.Request, formAction string)
 	} else if getFirstValue(r.Form, "org") != "" {
 		actOnOrgs(hc, formAction, r, conf)
 	}
+	unlock()
 
 	newRepo := parseAutoFillOptions(hc, userInfo.Provider, r.URL.Query())
 
@@ -158,6 +165,9 @@ func settingsHandler(w http.ResponseWriter, r *http.Request, formAction string)
 
 	t := make(map[string]string)
 	t["IsCronRunning"] = fmt.Sprintf("%v", isCronPresentFor(configFile))
+	if conf.Auth != nil {
+		t["PrivateAccessURL"] = conf.Auth.privateAccessURL()
+	}
 
 	page := kinli.NewPage(hc, "Edit/Add Repos to Track", userInfo, conf, t)
 	kinli.DisplayPage(w, "repos", page)
@@ -178,7 +188,7 @@ func actOnOrgs(hc *kinli.HttpContext, formAction string, r *http.Request, conf *
 			break
 		}
 
-		orgType, present := getRemoteOrgType(provider, conf.Auth.Token, orgName)
+		orgType, present := getRemoteOrgType(conf.Auth, orgName)
 		if present == false {
 			hc.AddFlash(fmt.Sprintf("Org/User Name Not Found with %s", provider))
 			return
@@ -242,14 +252,26 @@ func actOnRepos(hc *kinli.HttpContext, formAction string, r *http.Request, conf
 		var references []reference
 		var provider = conf.Auth.Provider
 
-		repoName := validateRepoName(getFirstValue(r.Form, "repo"))
+		repoName := validateRepoName(conf.Auth.Provider, getFirstValue(r.Form, "repo"))
 		if repoName == "" {
 			hc.AddFlash("Invalid Repo Name Provided")
 			break
 		}
 
-		repoPresent := validateRemoteRepoName(provider, conf.Auth.Token, repoName)
-		if !repoPresent {
+		if isPlainGitURL(repoName) {
+			provider = GitProvider
+		}
+
+		private, err := validateRemoteRepoName(provider, conf.Auth, repoName)
+		if err == errRepoNoAccess {
+			if accessURL := conf.Auth.privateAccessURL(); accessURL != "" {
+				hc.AddFlash("Could not access Repo on " + provider + ". If it is a private repository, grant access to private repositories from " + accessURL)
+			} else {
+				hc.AddFlash("You do not have access to the Repo on " + provider)
+			}
+			break
+		}
+		if err != nil {
 			hc.AddFlash("Could not find Repo on " + provider)
 			break
 		}
@@ -263,12 +285,43 @@ func actOnRepos(hc *kinli.HttpContext, formAction string, r *http.Request, conf
 		}
 
 		repo := &Repo{
-			repoName,
-			references,
-			contains(r.Form["branches"], "true"),
-			contains(r.Form["tags"], "true"),
-			provider,
+			Repo:                 repoName,
+			NamedReferences:      references,
+			Branches:             contains(r.Form["branches"], "true"),
+			Tags:                 contains(r.Form["tags"], "true"),
+			Releases:             contains(r.Form["releases"], "true"),
+			Provider:             provider,
+			Private:              private,
+			IncludePaths:         parsePathGlobs(r.Form["include_paths"]),
+			ExcludePaths:         parsePathGlobs(r.Form["exclude_paths"]),
+			TagInclude:           strings.TrimSpace(getFirstValue(r.Form, "tag_include")),
+			TagExclude:           strings.TrimSpace(getFirstValue(r.Form, "tag_exclude")),
+			TagIgnorePrereleases: contains(r.Form["tag_ignore_prereleases"], "true"),
+			BranchPatterns:       parsePathGlobs(r.Form["branch_patterns"]),
+			DeletedRefs:          contains(r.Form["deleted_refs"], "true"),
+			ForcePushAlert:       contains(r.Form["force_push_alert"], "true"),
+			PullRequests:         contains(r.Form["pull_requests"], "true"),
+			PullRequestBases:     parsePathGlobs(r.Form["pull_request_bases"]),
+			PullRequestLabels:    parseLabels(r.Form["pull_request_labels"]),
+			Issues:               contains(r.Form["issues"], "true"),
+			IssueLabels:          parseLabels(r.Form["issue_labels"]),
+		}
+		if state := getFirstValue(r.Form, "issue_state"); state == "open" || state == "closed" {
+			repo.IssueState = state
+		}
+		if bump := getFirstValue(r.Form, "tag_minimum_bump"); tagBumpLevels[bump] > 0 {
+			repo.TagMinimumBump = bump
+		}
+		if err := validateTagFilters(repo); err != nil {
+			hc.AddFlash("Invalid Tag Filter: " + err.Error())
+			break
+		}
+		client := getGitClientForProvider(provider, conf.Auth)
+		if _, ok := client.(commitComparer); repo.ForcePushAlert && !ok {
+			hc.AddFlash(featureNotSupported{provider, gitForcePush}.Error())
+			repo.ForcePushAlert = false
 		}
+		resolveRepoID(client, repo)
 
 		// TODO move method under repo/settings struct
 		info := upsertRepo(conf, repo)
@@ -286,7 +339,7 @@ func actOnRepos(hc *kinli.HttpContext, formAction string, r *http.Request, conf
 			}
 		}
 	case "delete":
-		repoName := validateRepoName(getFirstValue(r.Form, "repo"))
+		repoName := validateRepoName(conf.Auth.Provider, getFirstValue(r.Form, "repo"))
 		if repoName == "" {
 			hc.AddFlash("Invalid Repo Name Provided")
 			break
@@ -316,17 +369,42 @@ func actOnRepos(hc *kinli.HttpContext, formAction string, r *http.Request, conf
 
 }
 
-func validateRepoName(repo string) string {
+func validateRepoName(provider, repo string) string {
 	if repo == "" {
 		return ""
 	}
-	data := repoValidator.FindAllString(repo, -1)
+	if isPlainGitURL(repo) {
+		return validateGitURL(repo)
+	}
+	validator := repoValidator
+	if provider == GitlabProvider {
+		validator = nestedRepoValidator
+	}
+	data := validator.FindAllString(repo, -1)
 	if len(data) == 1 {
 		return data[0]
 	}
 	return ""
 }
 
+// validateGitURL accepts urls with a host or file:// urls when they are allowed
+func validateGitURL(repo string) string {
+	u, err := url.Parse(strings.TrimSpace(repo))
+	if err != nil || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return ""
+	}
+	if u.Scheme == "file" {
+		if config.GitAllowFileURLs && u.Path != "" {
+			return u.String()
+		}
+		return ""
+	}
+	if u.Host == "" || !gitHostAllowed(u.Hostname()) {
+		return ""
+	}
+	return u.String()
+}
+
 func validateOrgName(org string) string {
 	if org == "" {
 		return ""
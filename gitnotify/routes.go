@@ -15,6 +15,10 @@ import (
 const (
 	gitRefBranch     = "branches"
 	gitRefTag        = "tags"
+	gitRefRelease    = "releases"
+	gitPullRequest   = "pull requests"
+	gitIssue         = "issues"
+	gitForcePush     = "force push alerts"
 	formUpdateString = "update"
 )
 
@@ -28,6 +32,17 @@ var (
 	gitlabTreeURLEndPoint    string
 	gitlabCommitURLEndPoint  string
 	gitlabCompareURLEndPoint string
+
+	giteaRepoEndPoint       string
+	giteaTreeURLEndPoint    string
+	giteaCommitURLEndPoint  string
+	giteaCompareURLEndPoint string
+
+	bitbucketProjectEndPoint    string
+	bitbucketRepoEndPoint       string
+	bitbucketTreeURLEndPoint    string
+	bitbucketCommitURLEndPoint  string
+	bitbucketCompareURLEndPoint string
 )
 
 // InitRouter initialises the routes
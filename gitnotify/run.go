@@ -10,7 +10,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/aryann/difflib"
 	"github.com/sairam/kinli"
 )
 
@@ -25,10 +24,11 @@ func (userNotFound) Error() string {
 // contains oldList, newList of the branches
 // Used for tracking tags/branches/repoNames
 type gitBranchList struct {
-	repo    *Repo
-	option  string
-	oldList []string
-	newList []string
+	repo       *Repo
+	option     string
+	oldList    []string
+	newList    []string
+	oldCommits LocalCommitRef // commits of the old list when stored
 }
 
 func (g *gitBranchList) String() string {
@@ -37,8 +37,13 @@ func (g *gitBranchList) String() string {
 
 // gitCommitDiff tracks old and new commits
 type gitCommitDiff struct {
-	OldCommit string
-	NewCommit string
+	OldCommit  string
+	NewCommit  string
+	Comparison *gitComparison // commits between OldCommit and NewCommit when the provider can compare
+	// MatchedFiles are the changed files matching the path filters of the repo
+	MatchedFiles []string
+	// Deleted is set for a branch tracked through a pattern that no longer exists
+	Deleted bool
 }
 
 func (g *gitCommitDiff) shortOldCommit() string {
@@ -53,6 +58,11 @@ func (g *gitCommitDiff) changed() bool {
 	return g.OldCommit != g.NewCommit
 }
 
+// forcePushed is true when the old commit is no longer part of the branch
+func (g *gitCommitDiff) forcePushed() bool {
+	return g.Comparison != nil && g.Comparison.forcePushed()
+}
+
 func (g *gitCommitDiff) String() string {
 	return Stringify(g)
 }
@@ -60,20 +70,38 @@ func (g *gitCommitDiff) String() string {
 // gitRepoDiffs has the diff for a repoName that is being tracked
 // this is used to send emails / hooks
 type gitRepoDiffs struct {
-	RepoName   string
-	Provider   string
-	References map[string]*gitCommitDiff
-	RefList    []*gitRefList
+	RepoName     string
+	Provider     string
+	References   map[string]*gitCommitDiff
+	RefList      []*gitRefList
+	Releases     []*GitRelease
+	PullRequests []*pullRequestChange
+	Issues       []*GitIssue
+	Private      bool
+	// FetchErrors is keyed by branches/tags/releases/pull requests/issues. fetched_info is not updated for them
+	FetchErrors map[string]string
 }
 
 func (e *gitRepoDiffs) String() string {
 	return Stringify(e)
 }
 
+func (e *gitRepoDiffs) fetchFailed(option string, err error) {
+	statCount("run.fetch_failed")
+	log.Printf("Failed fetching %s for %s: %s", option, e.RepoName, err)
+	if e.FetchErrors == nil {
+		e.FetchErrors = make(map[string]string)
+	}
+	e.FetchErrors[option] = err.Error()
+}
+
 // gitRefList is used tracking Repo and Branch inside the diff
 type gitRefList struct {
 	Title      string
 	References []string
+	Bumps      map[string]string // semantic version bump of new tags
+	Deleted    bool
+	Commits    LocalCommitRef // last known commits of deleted references
 }
 
 func (e *gitRefList) String() string {
@@ -151,73 +179,190 @@ func processRepoDiffs(conf *Setting) (allLocalDiffs []*gitRepoDiffs, err error)
 		return nil, &userNotFound{}
 	}
 
-	client := getGitClient(conf.Auth.Provider, conf.Auth.Token)
-	branch := &gitBranchList{}
-
 	allLocalDiffs = make([]*gitRepoDiffs, 0, len(conf.Repos))
+	prefetched := prefetchRefs(conf.Auth, conf.Repos)
 
 	// loop through repos and their branches
 	for _, repo := range conf.Repos {
-		var localDiffs = &gitRepoDiffs{
-			RepoName: repo.Repo,
-			Provider: conf.Auth.Provider,
+		client := getGitClientForRepo(repo, conf.Auth)
+		// settings saved before ids were persisted are resolved on the next run
+		resolveRepoID(client, repo)
+		resolveRepoVisibility(client, repo, conf.Info, time.Now())
+		if refs := prefetched[repo.Repo]; refs != nil {
+			client = &prefetchedClient{client, refs}
+		}
+		localDiffs, err := processRepoDiff(client, repo, conf.Info)
+		if err != nil {
+			return nil, err
 		}
 		allLocalDiffs = append(allLocalDiffs, localDiffs)
+	}
+	return allLocalDiffs, nil
+}
 
-		// branch is reused here without creating new ones
-		branch.repo = repo
-
-		if repo.Branches || len(repo.NamedReferences) > 0 {
-			newBranches, _ := getNewInfo(client, branch, "branches")
-			if len(repo.NamedReferences) > 0 {
+// processRepoDiff diffs the refs of the repo with the information from the last run.
+// Refs that could not be fetched are part of FetchErrors and their information is left untouched.
+// Only errors that stop the run are returned, see stopsRun
+func processRepoDiff(client GitRemoteIface, repo *Repo, info map[string]*Information) (*gitRepoDiffs, error) {
+	var localDiffs = &gitRepoDiffs{
+		RepoName: repo.Repo,
+		Provider: repo.Provider,
+		Private:  repo.Private,
+	}
+	branch := &gitBranchList{repo: repo}
 
-				data := make(map[string]*gitCommitDiff)
-				b := conf.Info[repo.Repo]
-				// TODO set newInformation as part of the config loader
-				// TODO bug - if we are no longer tracking a branch, we need to remove it from the new list
-				if b == nil {
-					conf.Info[branch.repo.Repo] = newRepoInformation()
-					b = conf.Info[branch.repo.Repo]
-				}
-				for branch, commitID := range b.Repo.Commits {
-					data[branch] = &gitCommitDiff{
-						OldCommit: commitID,
-					}
+	if repo.Branches || len(repo.NamedReferences) > 0 {
+		newBranches, err := fetchRefs(client, branch, gitRefBranch, info)
+		if stopsRun(err) {
+			return nil, err
+		}
+		if err != nil {
+			localDiffs.fetchFailed(gitRefBranch, err)
+		} else if len(repo.NamedReferences) > 0 {
+
+			data := make(map[string]*gitCommitDiff)
+			b := info[repo.Repo]
+			// TODO set newInformation as part of the config loader
+			// TODO bug - if we are no longer tracking a branch, we need to remove it from the new list
+			if b == nil {
+				info[branch.repo.Repo] = newRepoInformation()
+				b = info[branch.repo.Repo]
+			}
+			for branch, commitID := range b.Repo.Commits {
+				data[branch] = &gitCommitDiff{
+					OldCommit: commitID,
 				}
+			}
 
-				// check if data still keeps the data
-				diffWithOldCommits(newBranches, branch, data)
-
-				for i, t := range data {
-					// save new data from commitDiff.data
-					if t.NewCommit != noneString {
-						b.Repo.Commits[i] = t.NewCommit
+			// check if data still keeps the data
+			diffWithOldCommits(newBranches, branch, data)
+			if err := compareCommits(client, repo, data); err != nil {
+				return nil, err
+			}
+			filterPaths(repo, data)
+
+			for i, t := range data {
+				// save new data from commitDiff.data
+				switch {
+				case t.NewCommit == "" || t.Deleted:
+					// no longer tracked. deleted branches are reported once, in the deleted branches when they are listed there
+					delete(b.Repo.Commits, i)
+					if t.NewCommit == "" || repo.reportsDeletedBranch(i, b.Repo.Branches) {
+						delete(data, i)
 					}
+				case t.NewCommit != noneString:
+					b.Repo.Commits[i] = t.NewCommit
 				}
-				localDiffs.References = data
 			}
+			localDiffs.References = data
+		}
 
-			if repo.Branches {
-				branchesDiff := diffWithOldBranches(newBranches, branch, "branches", conf.Info)
-				l := &gitRefList{
-					Title:      "Branches",
-					References: branchesDiff,
-				}
-				localDiffs.RefList = append(localDiffs.RefList, l)
+		if err == nil && repo.Branches {
+			branchesDiff, deletedBranches := diffWithOldBranches(newBranches, branch, "branches", info)
+			l := &gitRefList{
+				Title:      "Branches",
+				References: filterBranches(repo, branchesDiff),
+			}
+			localDiffs.RefList = append(localDiffs.RefList, l)
+			if repo.DeletedRefs {
+				localDiffs.RefList = append(localDiffs.RefList, deletedRefList("Branches", filterBranches(repo, deletedBranches), branch.oldCommits))
 			}
 		}
+	}
 
-		if repo.Tags {
-			newTags, _ := getNewInfo(client, branch, "tags")
-			tagsDiff := diffWithOldBranches(newTags, branch, "tags", conf.Info)
+	if repo.Tags {
+		newTags, err := fetchRefs(client, branch, gitRefTag, info)
+		if stopsRun(err) {
+			return nil, err
+		}
+		if err != nil {
+			localDiffs.fetchFailed(gitRefTag, err)
+		} else {
+			var oldTags []string
+			if t := info[repo.Repo]; t != nil {
+				oldTags = t.Repo.Tags
+			}
+			tagsDiff, deletedTags := diffWithOldBranches(newTags, branch, "tags", info)
 			l := &gitRefList{
 				Title:      "Tags",
 				References: tagsDiff,
 			}
+			if repo.hasTagFilters() {
+				l.References, l.Bumps = filterTags(repo, oldTags, tagsDiff)
+			}
 			localDiffs.RefList = append(localDiffs.RefList, l)
+			if repo.DeletedRefs {
+				localDiffs.RefList = append(localDiffs.RefList, deletedRefList("Tags", newTagFilter(repo).filter(deletedTags), branch.oldCommits))
+			}
 		}
 	}
-	return allLocalDiffs, nil
+
+	if repo.Releases {
+		releases, err := fetchReleases(client, repo, info)
+		if stopsRun(err) {
+			return nil, err
+		}
+		if err != nil {
+			localDiffs.fetchFailed(gitRefRelease, err)
+		} else {
+			localDiffs.Releases = diffWithOldReleases(releases, repo, info)
+		}
+	}
+
+	if repo.PullRequests {
+		pulls, err := diffPullRequests(client, repo, info, time.Now().UTC())
+		if stopsRun(err) {
+			return nil, err
+		}
+		if err != nil {
+			localDiffs.fetchFailed(gitPullRequest, err)
+		} else {
+			localDiffs.PullRequests = pulls
+		}
+	}
+
+	if repo.Issues {
+		issues, err := diffIssues(client, repo, info, time.Now().UTC())
+		if stopsRun(err) {
+			return nil, err
+		}
+		if err != nil {
+			localDiffs.fetchFailed(gitIssue, err)
+		} else {
+			localDiffs.Issues = issues
+		}
+	}
+	return localDiffs, nil
+}
+
+// emptyRefList is returned when no refs are listed for a repository that had refs in the last run
+type emptyRefList struct {
+	option string
+}
+
+func (e emptyRefList) Error() string {
+	return fmt.Sprintf("no %s were returned", e.option)
+}
+
+// fetchRefs treats an empty list as a failure when refs were found in the last run
+// since providers can return an empty list instead of an error.
+// providers return an error instead of a partial list, which would be reported as new branches/tags in the next run
+func fetchRefs(client GitRemoteIface, branch *gitBranchList, option string, info map[string]*Information) ([]*GitRefWithCommit, error) {
+	refs, err := getNewInfo(client, branch, option)
+	if err != nil || len(refs) > 0 {
+		return refs, err
+	}
+	t := info[branch.repo.Repo]
+	if t == nil {
+		return refs, nil
+	}
+	if option == gitRefBranch && (len(t.Repo.Branches) > 0 || len(t.Repo.Commits) > 0) {
+		return nil, emptyRefList{option}
+	}
+	if option == gitRefTag && len(t.Repo.Tags) > 0 {
+		return nil, emptyRefList{option}
+	}
+	return refs, nil
 }
 
 // This is the main logic that converts computed diff to representable diff
@@ -231,6 +376,21 @@ func makeRepoDiffs(repoDiffs []*gitRepoDiffs, conf *Setting) gnDiffDatum {
 		var datum []diffData
 		var repoChanged = false
 
+		// the user should know that the repository is not being tracked
+		for _, option := range []string{gitRefBranch, gitRefTag, gitRefRelease, gitPullRequest, gitIssue} {
+			fetchError, failed := diff.FetchErrors[option]
+			if !failed {
+				continue
+			}
+			repoChanged = true
+			datum = append(datum, diffData{
+				Title:      link{strings.Title(option), RepoLink(diff.Provider, diff.RepoName), "Error: "},
+				Error:      "Could not fetch " + option + ": " + fetchError,
+				ChangeType: "repoFetchError",
+				Changed:    true,
+			})
+		}
+
 		for branch, commit := range diff.References {
 			var data diffData
 			data.Title = link{branch, TreeLink(diff.Provider, diff.RepoName, branch), "Branch: "}
@@ -238,7 +398,12 @@ func makeRepoDiffs(repoDiffs []*gitRepoDiffs, conf *Setting) gnDiffDatum {
 			data.Changed = false
 			var changeLink link
 
-			if commit.OldCommit == "" {
+			if commit.Deleted {
+				data.Title.Href = CommitLink(diff.Provider, diff.RepoName, commit.OldCommit)
+				data.Error = "Branch Deleted. Last commit was " + commit.shortOldCommit()
+				data.Changed = true
+				repoChanged = true
+			} else if commit.OldCommit == "" {
 				if commit.NewCommit == noneString {
 					data.Error = "Branch Not Found"
 					data.Changed = true
@@ -260,6 +425,13 @@ func makeRepoDiffs(repoDiffs []*gitRepoDiffs, conf *Setting) gnDiffDatum {
 					CompareLink(diff.Provider, diff.RepoName, commit.OldCommit, commit.NewCommit),
 					"Code Diff:",
 				}
+				data.Commits, data.MoreCommits = commitLines(diff.Provider, diff.RepoName, commit.Comparison)
+				data.Stat = comparisonStat(commit.Comparison)
+				data.MatchedFiles = commit.MatchedFiles
+				if commit.forcePushed() {
+					data.ForcePushed = true
+					data.DroppedCommits = commit.Comparison.BehindBy
+				}
 			} else {
 				data.Changed = false
 			}
@@ -271,6 +443,10 @@ func makeRepoDiffs(repoDiffs []*gitRepoDiffs, conf *Setting) gnDiffDatum {
 			var data diffData
 			data.Title = link{t.Title, RepoLink(diff.Provider, diff.RepoName) + "/" + strings.ToLower(t.Title), "New " + strings.Title(t.Title) + ": "}
 			data.ChangeType = "repoRefDiff"
+			if t.Deleted {
+				data.Title.Title = "Deleted " + strings.Title(t.Title) + ": "
+				data.ChangeType = "repoRefDeleted"
+			}
 			var links []link
 
 			if len(t.References) == 0 {
@@ -279,36 +455,95 @@ func makeRepoDiffs(repoDiffs []*gitRepoDiffs, conf *Setting) gnDiffDatum {
 				data.Changed = true
 				repoChanged = true
 				for _, ref := range t.References {
-					links = append(links, link{ref, TreeLink(diff.Provider, diff.RepoName, ref), ""})
+					if t.Deleted {
+						// the ref no longer exists. link to the commit it pointed to when known
+						l := link{Text: ref}
+						if commit := t.Commits[ref]; commit != "" {
+							l.Href = CommitLink(diff.Provider, diff.RepoName, commit)
+							l.Title = shortCommit(commit)
+						}
+						links = append(links, l)
+						continue
+					}
+					links = append(links, link{ref, TreeLink(diff.Provider, diff.RepoName, ref), t.Bumps[ref]})
 				}
 				data.Changes = links
 			}
 			datum = append(datum, data)
 		}
+
+		for _, release := range diff.Releases {
+			repoChanged = true
+			href := release.URL
+			if href == "" {
+				href = TreeLink(diff.Provider, diff.RepoName, release.Tag)
+			}
+			datum = append(datum, diffData{
+				Title:      link{release.displayName(), href, "New Release: "},
+				ChangeType: "repoReleaseDiff",
+				Changed:    true,
+				Release:    release.note(),
+			})
+		}
+
+		for _, pull := range diff.PullRequests {
+			repoChanged = true
+			datum = append(datum, diffData{
+				Title:       link{fmt.Sprintf("#%d %s", pull.Number, pull.Title), pull.URL, "Pull Request " + strings.Title(pull.Event) + ": "},
+				ChangeType:  "repoPullRequestDiff",
+				Changed:     true,
+				PullRequest: pull.note(),
+			})
+		}
+
+		if len(diff.Issues) > 0 {
+			repoChanged = true
+			data := diffData{
+				Title:      link{"Issues", RepoLink(diff.Provider, diff.RepoName) + "/issues", "New Issues: "},
+				ChangeType: "repoIssueDiff",
+				Changed:    true,
+			}
+			for _, issue := range diff.Issues {
+				data.Issues = append(data.Issues, issue.note())
+			}
+			datum = append(datum, data)
+		}
+
 		diffs = append(diffs, &gnDiffData{
 			Repo:    link{diff.RepoName, RepoLink(diff.Provider, diff.RepoName), diff.RepoName},
 			Changed: repoChanged,
 			Data:    datum,
 			MadeFor: madefor,
+			Private: diff.Private,
 		})
 	}
 	return diffs
 }
 
+// stopsRun is true for errors that affect every repository of the user
+func stopsRun(err error) bool {
+	_, limited := isRateLimited(err)
+	return limited || isTokenExpired(err)
+}
+
 // Called from the cron job or force run job
-func processDiffForUser(conf *Setting) {
+// returns an error when the run has to be stopped, see stopsRun. conf should not be saved in that case
+func processDiffForUser(conf *Setting) error {
 	if !conf.anyValidNotifications() {
 		log.Printf("Not processing conf %s/%s since no valid notification mechanisms are found", conf.Auth.Provider, conf.Auth.UserName)
-		return
+		return nil
 	}
 	start := time.Now()
 
 	orgDiffs, err := processOrgDiffs(conf)
+	if stopsRun(err) {
+		return err
+	}
 
 	repoDiff, err := processRepoDiffs(conf)
 	if err != nil {
 		log.Printf("Failure processing %s/%s, %s\n", conf.Auth.Provider, conf.Auth.UserName, err)
-		return
+		return err
 	}
 
 	repoDiffs := makeRepoDiffs(repoDiff, conf)
@@ -327,11 +562,12 @@ func processDiffForUser(conf *Setting) {
 
 	if eligible := diffs.hasChanges(); !eligible {
 		log.Printf("No changes. Skipping Notifications")
-		return
+		return nil
 	}
 
 	processForMail(diffs, conf, fileName)
 	processForWebhook(diffs, conf)
+	return nil
 }
 
 // option can be tags or branches
@@ -340,10 +576,26 @@ func getNewInfo(client GitRemoteIface, branch *gitBranchList, option string) ([]
 	return getBranchTagInfo(client, branch)
 }
 
-func makeDiffForOrg(conf *Setting, o *Organisation, repoList []string, repoItems []*searchRepoItem) *gnDiffData {
+// makeDiffForOrg lists the new repositories with the given visibility
+func makeDiffForOrg(conf *Setting, o *Organisation, repoList []string, repoItems []*searchRepoItem, private bool) *gnDiffData {
 	var diff = &gnDiffData{}
 	diff.Repo = link{Text: o.Name, Href: RepoLink(o.Provider, o.Name)}
 	diff.MadeFor = conf.Auth.UserInfo()
+	diff.Private = private
+
+	items := make(map[string]*searchRepoItem, len(repoItems))
+	for _, item := range repoItems {
+		if item.Private == private {
+			items[item.Name] = item
+		}
+	}
+	var names []string
+	for _, name := range repoList {
+		if items[name] != nil {
+			names = append(names, name)
+		}
+	}
+	repoList = names
 
 	if len(repoList) > 0 {
 		diff.Changed = true
@@ -356,18 +608,22 @@ func makeDiffForOrg(conf *Setting, o *Organisation, repoList []string, repoItems
 	d.Changed = true
 	d.ChangeType = "orgRepoDiff"
 	d.Title = link{Text: o.Name, Href: RepoLink(o.Provider, o.Name)}
-	for _, item := range repoItems {
-		if StringIn(repoList, item.Name) {
-			l := link{
-				Text:  item.Name,
-				Href:  RepoLink(o.Provider, o.Name+"/"+item.Name),
-				Title: item.Description,
-			}
-			if item.HomePage != "" {
-				l.Title += " (" + item.HomePage + ")"
-			}
-			d.Changes = append(d.Changes, l)
+	// repoList is sorted, the items are in the order of the api
+	for _, name := range repoList {
+		item := items[name]
+		path := o.Name + "/" + item.Name
+		if item.Path != "" {
+			path = item.Path
+		}
+		l := link{
+			Text:  item.Name,
+			Href:  RepoLink(o.Provider, path),
+			Title: item.Description,
+		}
+		if item.HomePage != "" {
+			l.Title += " (" + item.HomePage + ")"
 		}
+		d.Changes = append(d.Changes, l)
 	}
 	diff.Data = []diffData{d}
 
@@ -377,9 +633,12 @@ func makeDiffForOrg(conf *Setting, o *Organisation, repoList []string, repoItems
 func processOrgDiffs(conf *Setting) (gnDiffDatum, error) {
 	var diffs gnDiffDatum
 
-	client := getGitClient(conf.Auth.Provider, conf.Auth.Token)
 	for _, org := range conf.Orgs {
+		client := getGitClientForOrg(org, conf.Auth)
 		reposList, err := client.ReposForUser(org.Name)
+		if stopsRun(err) {
+			return nil, err
+		}
 		if err != nil {
 			log.Println(err)
 			continue
@@ -402,9 +661,13 @@ func processOrgDiffs(conf *Setting) (gnDiffDatum, error) {
 			currentList = append(currentList, r.Name)
 		}
 
-		onlyNew := getNewStrings(orgInfo.Repos, currentList)
-		newDiff := makeDiffForOrg(conf, org, onlyNew, reposList)
-		diffs = append(diffs, newDiff)
+		onlyNew, _ := diffStrings(orgInfo.Repos, currentList)
+		sortRefs(onlyNew, "repos")
+		// private repositories are listed separately so that they are not sent to webhooks unless the user allows it
+		diffs = append(diffs, makeDiffForOrg(conf, org, onlyNew, reposList, false))
+		if private := makeDiffForOrg(conf, org, onlyNew, reposList, true); private.Changed {
+			diffs = append(diffs, private)
+		}
 		orgInfo.Repos = currentList
 		// we need to set again since this is not a reference
 		conf.Info[org.Name].Org = orgInfo
@@ -414,22 +677,46 @@ func processOrgDiffs(conf *Setting) (gnDiffDatum, error) {
 
 }
 
-// FIXME
-func diffWithOldBranches(v []*GitRefWithCommit, branch *gitBranchList, option string, info map[string]*Information) []string {
+// diffWithOldBranches returns the new and the deleted refs.
+// The commits of the refs are stored when the repo reports deleted refs
+func diffWithOldBranches(v []*GitRefWithCommit, branch *gitBranchList, option string, info map[string]*Information) ([]string, []string) {
 	newBranches := make([]string, len(v))
 	for i, a := range v {
 		newBranches[i] = a.Name
 	}
+	// commits are stored only for the refs reported when deleted
+	var commits LocalCommitRef
+	if branch.repo.DeletedRefs {
+		reported := newBranches
+		if option == gitRefTag {
+			reported = newTagFilter(branch.repo).filter(newBranches)
+		} else if option == gitRefBranch {
+			reported = filterBranches(branch.repo, newBranches)
+		}
+		all := make(LocalCommitRef)
+		for _, a := range v {
+			all[a.Name] = a.Commit
+		}
+		commits = make(LocalCommitRef)
+		for _, name := range reported {
+			commits[name] = all[name]
+		}
+	}
 
 	branch.newList = newBranches
+	branch.oldList, branch.oldCommits = nil, nil
 	t := info[branch.repo.Repo]
 	if option == "tags" && t != nil {
 		branch.oldList = t.Repo.Tags
+		branch.oldCommits = t.Repo.TagCommits
 	} else if option == "branches" && t != nil {
 		branch.oldList = t.Repo.Branches
+		branch.oldCommits = t.Repo.BranchCommits
 	}
 
-	diff := getNewStrings(branch.oldList, branch.newList)
+	diff, deleted := diffStrings(branch.oldList, branch.newList)
+	sortRefs(diff, option)
+	sortRefs(deleted, option)
 	if t == nil {
 		info[branch.repo.Repo] = newRepoInformation()
 		t = info[branch.repo.Repo]
@@ -437,29 +724,32 @@ func diffWithOldBranches(v []*GitRefWithCommit, branch *gitBranchList, option st
 
 	if option == gitRefTag {
 		t.Repo.Tags = branch.newList
+		t.Repo.TagCommits = commits
 	} else if option == gitRefBranch {
 		t.Repo.Branches = branch.newList
+		t.Repo.BranchCommits = commits
 	}
 
-	return diff
+	return diff, deleted
 }
 
-func getNewStrings(old, new []string) []string {
-	strs := make([]string, 0, 1)
-	for _, s := range difflib.Diff(old, new) {
-		if s.Delta == difflib.RightOnly {
-			strs = append(strs, s.Payload)
+// deletedRefList keeps the last known commit of each deleted reference
+func deletedRefList(title string, deleted []string, oldCommits LocalCommitRef) *gitRefList {
+	l := &gitRefList{Title: title, References: deleted, Deleted: true, Commits: make(LocalCommitRef)}
+	for _, ref := range deleted {
+		if commit, ok := oldCommits[ref]; ok {
+			l.Commits[ref] = commit
 		}
 	}
-	return strs
+	return l
 }
 
 // in the branches we are tracking,
 // newcommit is "" // means that we are no longer tracking the branch/ref
 // newcommit is <none> if branch is not found/deleted in remote
+// branch patterns are expanded with the branches in remote. Deleted branches matching a pattern are marked as Deleted
 func diffWithOldCommits(v []*GitRefWithCommit, branch *gitBranchList, data map[string]*gitCommitDiff) {
-	for _, a := range branch.repo.NamedReferences {
-		s := string(a)
+	for _, s := range branch.repo.trackedBranches(v) {
 		c := data[s]
 		if c == nil {
 			c = &gitCommitDiff{}
@@ -467,6 +757,12 @@ func diffWithOldCommits(v []*GitRefWithCommit, branch *gitBranchList, data map[s
 		}
 		c.NewCommit = findBranchCommit(v, s)
 	}
+	for s, c := range data {
+		if c.NewCommit == "" && c.OldCommit != "" && branch.repo.matchesBranchPattern(s) {
+			c.NewCommit = noneString
+			c.Deleted = true
+		}
+	}
 }
 
 func findBranchCommit(v []*GitRefWithCommit, branch string) string {
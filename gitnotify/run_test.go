@@ -0,0 +1,233 @@
+package gitnotify
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeRemote returns the configured refs or errors
+type fakeRemote struct {
+	*localGitnull
+	branches   []*GitRefWithCommit
+	tags       []*GitRefWithCommit
+	releases   []*GitRelease
+	pulls      []*GitPullRequest
+	issues     []*GitIssue
+	comparison *gitComparison
+	branchErr  error
+	tagErr     error
+}
+
+func (f *fakeRemote) Branches(_ string) ([]*GitRefWithCommit, error) {
+	return f.branches, f.branchErr
+}
+
+func (f *fakeRemote) Tags(_ string) ([]*GitRefWithCommit, error) {
+	return f.tags, f.tagErr
+}
+
+func (f *fakeRemote) Releases(_ string) ([]*GitRelease, error) {
+	return f.releases, nil
+}
+
+// PullRequests returns the pull requests updated after since like the providers
+func (f *fakeRemote) PullRequests(_ string, since time.Time) ([]*GitPullRequest, error) {
+	var pulls []*GitPullRequest
+	for _, p := range f.pulls {
+		if p.UpdatedAt.After(since) {
+			pulls = append(pulls, p)
+		}
+	}
+	return pulls, nil
+}
+
+func (f *fakeRemote) Issues(_ string, since time.Time) ([]*GitIssue, error) {
+	var issues []*GitIssue
+	for _, i := range f.issues {
+		if i.UpdatedAt.After(since) {
+			issues = append(issues, i)
+		}
+	}
+	return issues, nil
+}
+
+func (f *fakeRemote) Compare(_, _, _ string) (*gitComparison, error) {
+	return f.comparison, nil
+}
+
+func refs(names ...string) []*GitRefWithCommit {
+	list := make([]*GitRefWithCommit, 0, len(names))
+	for _, name := range names {
+		list = append(list, &GitRefWithCommit{Name: name, Commit: name + "-commit"})
+	}
+	return list
+}
+
+func storedInfo() map[string]*Information {
+	info := newRepoInformation()
+	info.Repo.Branches = []string{"master", "develop"}
+	info.Repo.Tags = []string{"v1.0.0"}
+	info.Repo.Commits["master"] = "old-commit"
+	return map[string]*Information{"acme/widgets": info}
+}
+
+func TestProcessRepoDiffKeepsInfoOnFetchError(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", NamedReferences: []reference{"master"}, Branches: true, Tags: true}
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		branchErr:    errors.New("502 bad gateway"),
+		tags:         refs("v1.0.0", "v1.1.0"),
+	}
+	info := storedInfo()
+
+	diff, err := processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := info["acme/widgets"].Repo
+	if !reflect.DeepEqual(stored.Branches, []string{"master", "develop"}) || stored.Commits["master"] != "old-commit" {
+		t.Errorf("stored branches should not change on a failed fetch, got %v %v", stored.Branches, stored.Commits)
+	}
+	if !reflect.DeepEqual(stored.Tags, []string{"v1.0.0", "v1.1.0"}) {
+		t.Errorf("tags were fetched and should be updated, got %v", stored.Tags)
+	}
+	if diff.FetchErrors[gitRefBranch] == "" || diff.FetchErrors[gitRefTag] != "" {
+		t.Errorf("expected only branches to fail, got %v", diff.FetchErrors)
+	}
+	if len(diff.References) != 0 {
+		t.Errorf("tracked branches should not be reported as not found, got %v", diff.References)
+	}
+
+	conf := &Setting{Auth: &Authentication{Provider: GithubProvider}}
+	diffs := makeRepoDiffs([]*gitRepoDiffs{diff}, conf)
+	if len(diffs) != 1 || !diffs[0].Changed {
+		t.Fatalf("expected the repository to be reported, got %v", diffs)
+	}
+	fetchError := diffs[0].Data[0]
+	if fetchError.ChangeType != "repoFetchError" || !fetchError.Changed || fetchError.Error == "" {
+		t.Errorf("expected an error entry for branches, got %+v", fetchError)
+	}
+}
+
+func TestProcessRepoDiffEmptyListIsAFailure(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", Branches: true, Tags: true}
+	remote := &fakeRemote{localGitnull: &localGitnull{GithubProvider}}
+	info := storedInfo()
+
+	diff, err := processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.FetchErrors) != 2 {
+		t.Errorf("empty lists should be failures when refs were stored, got %v", diff.FetchErrors)
+	}
+	if len(info["acme/widgets"].Repo.Branches) != 2 || len(info["acme/widgets"].Repo.Tags) != 1 {
+		t.Errorf("stored refs should not change, got %v", info["acme/widgets"].Repo)
+	}
+
+	// the first run of a repository without tags is not a failure
+	repo = &Repo{Repo: "acme/new", Tags: true}
+	diff, err = processRepoDiff(remote, repo, info)
+	if err != nil || len(diff.FetchErrors) != 0 {
+		t.Errorf("expected no errors for a repository without stored refs, got %v %v", diff.FetchErrors, err)
+	}
+}
+
+func TestProcessRepoDiffStopsWhenRateLimited(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", Branches: true}
+	remote := &fakeRemote{localGitnull: &localGitnull{GithubProvider}, branchErr: rateLimited{}}
+
+	if _, err := processRepoDiff(remote, repo, storedInfo()); err == nil {
+		t.Error("expected the run to stop when rate limited")
+	}
+}
+
+func TestProcessRepoDiffDeletedRefs(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", Provider: GithubProvider, Branches: true, Tags: true, DeletedRefs: true}
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		branches:     refs("master", "develop", "release/1.0"),
+		tags:         refs("v1.0.0"),
+	}
+	info := storedInfo()
+
+	// the commits are not known for refs stored before deleted refs were reported
+	if _, err := processRepoDiff(remote, repo, info); err != nil {
+		t.Fatal(err)
+	}
+	if info["acme/widgets"].Repo.BranchCommits["release/1.0"] != "release/1.0-commit" {
+		t.Fatalf("expected the commits of branches to be stored, got %v", info["acme/widgets"].Repo.BranchCommits)
+	}
+
+	remote.branches = refs("master", "develop")
+	remote.tags = refs("v1.1.0")
+	diff, err := processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &Setting{Auth: &Authentication{Provider: GithubProvider}}
+	var deleted []diffData
+	for _, data := range makeRepoDiffs([]*gitRepoDiffs{diff}, conf)[0].Data {
+		if data.ChangeType == "repoRefDeleted" && data.Changed {
+			deleted = append(deleted, data)
+		}
+	}
+	if len(deleted) != 2 {
+		t.Fatalf("expected deleted branches and tags, got %+v", deleted)
+	}
+	branch, tag := deleted[0].Changes[0], deleted[1].Changes[0]
+	if branch.Text != "release/1.0" || branch.Href != CommitLink(GithubProvider, "acme/widgets", "release/1.0-commit") {
+		t.Errorf("expected a link to the last commit of release/1.0, got %+v", branch)
+	}
+	if tag.Text != "v1.0.0" || tag.Href != CommitLink(GithubProvider, "acme/widgets", "v1.0.0-commit") {
+		t.Errorf("expected a link to the last commit of v1.0.0, got %+v", tag)
+	}
+}
+
+func TestProcessRepoDiffDeletedRefsStoresFilteredCommits(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", Provider: GithubProvider, Branches: true, Tags: true, DeletedRefs: true,
+		BranchPatterns: []string{"release/*"}, TagInclude: `^v\d`}
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		branches:     refs("master", "release/1.0"),
+		tags:         refs("v1.0.0", "nightly"),
+	}
+	info := storedInfo()
+
+	if _, err := processRepoDiff(remote, repo, info); err != nil {
+		t.Fatal(err)
+	}
+	stored := info["acme/widgets"].Repo
+	if len(stored.BranchCommits) != 1 || stored.BranchCommits["release/1.0"] == "" {
+		t.Errorf("expected only the commits of branches matching the patterns, got %v", stored.BranchCommits)
+	}
+	if len(stored.TagCommits) != 1 || stored.TagCommits["v1.0.0"] == "" {
+		t.Errorf("expected only the commits of tags matching the filters, got %v", stored.TagCommits)
+	}
+	if len(stored.Branches) != 2 || len(stored.Tags) != 2 {
+		t.Errorf("expected every ref to be stored, got %v %v", stored.Branches, stored.Tags)
+	}
+}
+
+func TestMakeDiffForOrgSeparatesPrivateRepos(t *testing.T) {
+	conf := &Setting{Auth: &Authentication{Provider: GitlabProvider, UserName: "jdoe"}}
+	org := &Organisation{Name: "acme", Provider: GitlabProvider}
+	items := []*searchRepoItem{{Name: "widgets"}, {Name: "secret", Private: true}, {Name: "gadgets"}}
+	repoList := []string{"gadgets", "secret", "widgets"}
+
+	public := makeDiffForOrg(conf, org, repoList, items, false)
+	if public.Private || len(public.Data[0].Changes) != 2 || public.Data[0].Changes[0].Text != "gadgets" {
+		t.Errorf("expected only the public repositories, got %+v", public)
+	}
+	private := makeDiffForOrg(conf, org, repoList, items, true)
+	if !private.Private || len(private.Data[0].Changes) != 1 || private.Data[0].Changes[0].Text != "secret" {
+		t.Errorf("expected the private repositories marked private, got %+v", private)
+	}
+	diffs := gnDiffDatum{public, private}
+	if len(diffs.withoutPrivate()) != 1 {
+		t.Errorf("expected private repositories to be left out of webhooks, got %v", diffs.withoutPrivate())
+	}
+}
@@ -0,0 +1,102 @@
+package gitnotify
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// tags like v1.2.3, 1.2, 1.2.3-rc.1+build.5
+var semverPattern = regexp.MustCompile(`^[vV]?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+type semver struct {
+	Major, Minor, Patch int
+	Prerelease          string
+}
+
+func parseSemver(tag string) (*semver, bool) {
+	m := semverPattern.FindStringSubmatch(tag)
+	if m == nil {
+		return nil, false
+	}
+	v := &semver{Prerelease: m[4]}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	return v, true
+}
+
+func (v *semver) isPrerelease() bool {
+	return v.Prerelease != ""
+}
+
+// compare returns -1, 0 or 1. A pre-release is lower than its release
+func (v *semver) compare(o *semver) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		} else if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// comparePrerelease compares dot separated identifiers, numeric identifiers are compared as numbers
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case aErr == nil && bErr != nil:
+			return -1
+		case aErr != nil && bErr == nil:
+			return 1
+		case as[i] < bs[i]:
+			return -1
+		case as[i] > bs[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// bump is the part of the version that increased from the previous version.
+// Empty when the version is not higher than the previous version
+func (v *semver) bump(previous *semver) string {
+	if previous == nil {
+		return "initial"
+	}
+	if v.compare(previous) <= 0 {
+		return ""
+	}
+	switch {
+	case v.Major != previous.Major:
+		return "major"
+	case v.Minor != previous.Minor:
+		return "minor"
+	case v.Patch != previous.Patch:
+		return "patch"
+	}
+	return "prerelease"
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -18,6 +19,9 @@ type Setting struct {
 	Auth    *Authentication         `yaml:"auth"`
 	User    *UserNotification       `yaml:"user_notification"`
 	Info    map[string]*Information `yaml:"fetched_info"`
+
+	PostponedUntil *time.Time `yaml:"postponed_until,omitempty"` // last run was postponed due to rate limiting
+	ReauthRequired bool       `yaml:"reauth_required,omitempty"` // token was rejected. cron is stopped until the user logs in
 }
 
 func (c *Setting) usersEmail() string {
@@ -47,8 +51,9 @@ type UserNotification struct {
 	Disabled  bool   `yaml:"disabled"`
 	Frequency `yaml:",inline"`
 
-	WebhookURL  string `yaml:"webhook_url"`
-	WebhookType string `yaml:"webhook_type"`
+	WebhookURL     string `yaml:"webhook_url"`
+	WebhookType    string `yaml:"webhook_type"`
+	WebhookPrivate bool   `yaml:"webhook_private"` // webhooks are usually shared channels, private repositories are left out by default
 }
 
 func (u *UserNotification) isValidWebhook() bool {
@@ -121,6 +126,16 @@ type RepoInformation struct {
 	Tags     []string       `yaml:"tags,omitempty,flow"`
 	Branches []string       `yaml:"branches,omitempty,flow"`
 	Commits  LocalCommitRef `yaml:"commits,omitempty"`
+	Releases []string       `yaml:"releases,omitempty,flow"` // ids of the latest releases
+	// commits of the branches and tags that pass the filters, stored when deleted refs are reported
+	BranchCommits LocalCommitRef `yaml:"branch_commits,omitempty"`
+	TagCommits    LocalCommitRef `yaml:"tag_commits,omitempty"`
+	// pull requests updated after this time are listed in the next run
+	PullRequestsSince *time.Time `yaml:"pull_requests_since,omitempty"`
+	// update time of the newest issue listed
+	IssuesSince *time.Time `yaml:"issues_since,omitempty"`
+	// last time the visibility of the repository was fetched
+	VisibilityCheckedAt *time.Time `yaml:"visibility_checked_at,omitempty"`
 }
 
 func newRepoInformation() *Information {
@@ -149,8 +164,41 @@ type Repo struct {
 	NamedReferences []reference `yaml:"commits"`
 	Branches        bool        `yaml:"new_branches"`
 	Tags            bool        `yaml:"new_tags"`
+	Releases        bool        `yaml:"releases"`
 	Provider        string
+	ID              string `yaml:"id,omitempty"`      // gitlab project id. does not change when the project is renamed
+	Private         bool   `yaml:"private,omitempty"` // refreshed once a day
+	// tracked branches are reported only when files matching the globs changed
+	IncludePaths []string `yaml:"include_paths,omitempty"`
+	ExcludePaths []string `yaml:"exclude_paths,omitempty"`
+	// new tags are reported when matching the filters. the bump is one of major, minor or patch
+	TagInclude           string `yaml:"tag_include,omitempty"`
+	TagExclude           string `yaml:"tag_exclude,omitempty"`
+	TagIgnorePrereleases bool   `yaml:"tag_ignore_prereleases,omitempty"`
+	TagMinimumBump       string `yaml:"tag_minimum_bump,omitempty"`
+	// new branches are reported when matching one of the globs
+	BranchPatterns []string `yaml:"branch_patterns,omitempty"`
+	DeletedRefs    bool     `yaml:"deleted_refs,omitempty"` // report deleted branches and tags
+	// force pushes to tracked branches are notified immediately instead of waiting for the schedule
+	ForcePushAlert bool `yaml:"force_push_alert,omitempty"`
+	// pull requests opened, merged or closed are reported when matching the base branch globs and one of the labels
+	PullRequests      bool     `yaml:"pull_requests,omitempty"`
+	PullRequestBases  []string `yaml:"pull_request_bases,omitempty"`
+	PullRequestLabels []string `yaml:"pull_request_labels,omitempty"`
+	// new issues are reported when they have one of the labels and are in the state (open or closed)
+	Issues      bool     `yaml:"issues,omitempty"`
+	IssueLabels []string `yaml:"issue_labels,omitempty"`
+	IssueState  string   `yaml:"issue_state,omitempty"`
 }
+
+// remoteName is used for api calls. Links continue to use the repository name
+func (r *Repo) remoteName() string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return r.Repo
+}
+
 type reference string
 
 func (c *Setting) String() string {
@@ -185,6 +233,9 @@ func (c *Setting) load(settingFile string) error {
 	if c.Auth.Provider != "" {
 		for _, repo := range c.Repos {
 			repo.Provider = c.Auth.Provider
+			if isPlainGitURL(repo.Repo) {
+				repo.Provider = GitProvider
+			}
 		}
 	}
 
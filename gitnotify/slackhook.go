@@ -45,11 +45,24 @@ type SlackTypeLink struct {
 
 // <http://www.amazon.com|Amazon>
 func (s *SlackTypeLink) String() string {
-	return fmt.Sprintf("<%s|%s>", s.Href, s.Text)
+	return fmt.Sprintf("<%s|%s>", s.Href, slackEscape(s.Text))
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackEscape escapes the control characters of slack in text from the provider like titles, commit messages and authors
+func slackEscape(text string) string {
+	return slackEscaper.Replace(text)
 }
 
 func processForWebhook(diff gnDiffDatum, conf *Setting) error {
 	if conf.User.isValidWebhook() {
+		if !conf.User.WebhookPrivate {
+			diff = diff.withoutPrivate()
+			if !diff.hasChanges() {
+				return nil
+			}
+		}
 		statCount("notify.webhook")
 		if conf.User.WebhookType == "slack" {
 			log.Print("POSTing on a Slack Hook")
@@ -96,14 +109,101 @@ func processForSlack(diffs []*gnDiffData, slackURL string) error {
 			if diff.Changed == false {
 				continue
 			}
-			if diff.ChangeType == "repoBranchDiff" && len(diff.Changes) > 0 {
+			if diff.ChangeType == "repoFetchError" || diff.ChangeType == "accessExpired" {
+				attachment := SlackAttachment{
+					Title:          (&SlackTypeLink{diff.Title.Text, diff.Title.Href}).String(),
+					Text:           diff.Error,
+					Color:          "danger",
+					MarkdownFormat: []string{},
+				}
+				attachments = append(attachments, attachment)
+			} else if diff.ChangeType == "repoReleaseDiff" {
+				attachment := SlackAttachment{
+					Title:          diff.Title.Title + (&SlackTypeLink{diff.Title.Text, diff.Title.Href}).String(),
+					Text:           slackEscape(diff.Release.Excerpt),
+					Fields:         []SlackAttachmentField{{Title: "Tag", Value: slackEscape(diff.Release.Tag), Short: true}},
+					MarkdownFormat: []string{},
+				}
+				if diff.Release.Prerelease {
+					attachment.Color = "warning"
+					attachment.Fields = append(attachment.Fields, SlackAttachmentField{Title: "Pre-release", Value: "Yes", Short: true})
+				}
+				attachments = append(attachments, attachment)
+			} else if diff.ChangeType == "repoPullRequestDiff" {
+				fields := []SlackAttachmentField{
+					{Title: "Author", Value: slackEscape(diff.PullRequest.Author), Short: true},
+					{Title: "Base", Value: slackEscape(diff.PullRequest.Base), Short: true},
+				}
+				if len(diff.PullRequest.Labels) > 0 {
+					fields = append(fields, SlackAttachmentField{Title: "Labels", Value: slackEscape(strings.Join(diff.PullRequest.Labels, ", ")), Short: false})
+				}
+				attachment := SlackAttachment{
+					Title:          diff.Title.Title + (&SlackTypeLink{diff.Title.Text, diff.Title.Href}).String(),
+					Fields:         fields,
+					MarkdownFormat: []string{},
+				}
+				if diff.PullRequest.Event == "merged" {
+					attachment.Color = "good"
+				}
+				attachments = append(attachments, attachment)
+			} else if diff.ChangeType == "repoIssueDiff" {
+				var lines []string
+				for _, issue := range diff.Issues {
+					line := fmt.Sprintf("%s by %s", &SlackTypeLink{fmt.Sprintf("#%d %s", issue.Number, issue.Title), issue.Href}, slackEscape(issue.Author))
+					if len(issue.Labels) > 0 {
+						line += " [" + slackEscape(strings.Join(issue.Labels, ", ")) + "]"
+					}
+					lines = append(lines, line)
+				}
+				attachment := SlackAttachment{
+					Title:          (&SlackTypeLink{diff.Title.Title, diff.Title.Href}).String(),
+					Text:           strings.Join(lines, "\n"),
+					MarkdownFormat: []string{"text"},
+				}
+				attachments = append(attachments, attachment)
+			} else if diff.ChangeType == "repoRefDeleted" {
+				var lines []string
+				for _, change := range diff.Changes {
+					line := slackEscape(change.Text)
+					if change.Href != "" {
+						line += " was at " + (&SlackTypeLink{"`" + change.Title + "`", change.Href}).String()
+					}
+					lines = append(lines, line)
+				}
+				attachment := SlackAttachment{
+					Title:          diff.Title.Title,
+					Text:           strings.Join(lines, "\n"),
+					Color:          "warning",
+					MarkdownFormat: []string{"text"},
+				}
+				attachments = append(attachments, attachment)
+			} else if diff.ChangeType == "repoBranchDiff" && len(diff.Changes) > 0 {
 				if diff.Error == "" {
 					a := diff.Changes[0]
+					lines := []string{(&SlackTypeLink{a.Text, a.Href}).String()}
+					if diff.ForcePushed {
+						lines = append(lines, fmt.Sprintf("*Force pushed: %d commits dropped from the branch*", diff.DroppedCommits))
+					}
+					if s := diff.Stat; s != nil {
+						lines = append(lines, fmt.Sprintf("%d commits, %d files changed, +%d -%d", s.Commits, s.FilesChanged, s.Additions, s.Deletions))
+					}
+					if len(diff.MatchedFiles) > 0 {
+						lines = append(lines, "Matching files: "+slackEscape(strings.Join(diff.MatchedFiles, ", ")))
+					}
+					for _, c := range diff.Commits {
+						lines = append(lines, fmt.Sprintf("%s %s - %s", &SlackTypeLink{"`" + c.ShortSHA + "`", c.Href}, slackEscape(c.Message), slackEscape(c.Author)))
+					}
+					if diff.MoreCommits > 0 {
+						lines = append(lines, fmt.Sprintf("and %d more", diff.MoreCommits))
+					}
 					attachment := SlackAttachment{
 						Title:          (&SlackTypeLink{diff.Title.Text, diff.Title.Href}).String(),
-						Text:           (&SlackTypeLink{a.Text, a.Href}).String(),
+						Text:           strings.Join(lines, "\n"),
 						MarkdownFormat: []string{"text"},
 					}
+					if diff.ForcePushed {
+						attachment.Color = "danger"
+					}
 					attachments = append(attachments, attachment)
 				} else {
 					attachment := SlackAttachment{
@@ -117,7 +217,11 @@ func processForSlack(diffs []*gnDiffData, slackURL string) error {
 			} else {
 				var links []string
 				for _, change := range diff.Changes {
-					links = append(links, (&SlackTypeLink{change.Text, change.Href}).String())
+					l := (&SlackTypeLink{change.Text, change.Href}).String()
+					if change.Title != "" {
+						l += " (" + slackEscape(change.Title) + ")"
+					}
+					links = append(links, l)
 				}
 
 				attachment := SlackAttachment{
@@ -129,9 +233,13 @@ func processForSlack(diffs []*gnDiffData, slackURL string) error {
 			}
 		}
 
+		text := fmt.Sprintf("*Changes for %s*:", &SlackTypeLink{repo.Repo.Text, repo.Repo.Href})
+		if repo.Private {
+			text = fmt.Sprintf("*Changes for %s* (Private):", &SlackTypeLink{repo.Repo.Text, repo.Repo.Href})
+		}
 		message := &SlackMessage{
 			Username:    "gitnotify",
-			Text:        fmt.Sprintf("*Changes for %s*:", &SlackTypeLink{repo.Repo.Text, repo.Repo.Href}),
+			Text:        text,
 			Attachments: attachments,
 		}
 
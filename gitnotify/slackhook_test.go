@@ -0,0 +1,14 @@
+package gitnotify
+
+import "testing"
+
+func TestSlackTypeLinkEscapes(t *testing.T) {
+	link := &SlackTypeLink{"Fix <script> & <@channel> mentions", "https://github.com/acme/widgets/pull/7?a=1&b=2"}
+	expected := "<https://github.com/acme/widgets/pull/7?a=1&b=2|Fix &lt;script&gt; &amp; &lt;@channel&gt; mentions>"
+	if link.String() != expected {
+		t.Errorf("expected %q, got %q", expected, link.String())
+	}
+	if slackEscape("a < b > c & d") != "a &lt; b &gt; c &amp; d" {
+		t.Errorf("unexpected escape %q", slackEscape("a < b > c & d"))
+	}
+}
@@ -0,0 +1,117 @@
+package gitnotify
+
+import (
+	"log"
+	"regexp"
+)
+
+// Every new tag is stored, filtered tags are only left out of notifications
+
+var tagBumpLevels = map[string]int{"major": 3, "minor": 2, "patch": 1}
+
+// tagFilter holds the compiled tag filters of a repository
+type tagFilter struct {
+	include, exclude *regexp.Regexp
+	repo             *Repo
+}
+
+func (r *Repo) hasTagFilters() bool {
+	return r.TagInclude != "" || r.TagExclude != "" || r.TagIgnorePrereleases || r.TagMinimumBump != ""
+}
+
+// validateTagFilters returns the error of an invalid regular expression
+func validateTagFilters(r *Repo) error {
+	for _, expr := range []string{r.TagInclude, r.TagExclude} {
+		if _, err := regexp.Compile(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTagFilter(r *Repo) *tagFilter {
+	f := &tagFilter{repo: r}
+	var err error
+	if r.TagInclude != "" {
+		if f.include, err = regexp.Compile(r.TagInclude); err != nil {
+			log.Printf("Ignoring include filter of %s: %s", r.Repo, err)
+		}
+	}
+	if r.TagExclude != "" {
+		if f.exclude, err = regexp.Compile(r.TagExclude); err != nil {
+			log.Printf("Ignoring exclude filter of %s: %s", r.Repo, err)
+		}
+	}
+	return f
+}
+
+// matches applies the regular expressions and the pre-release filter
+func (f *tagFilter) matches(tag string) bool {
+	if f.include != nil && !f.include.MatchString(tag) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(tag) {
+		return false
+	}
+	if v, ok := parseSemver(tag); ok && v.isPrerelease() && f.repo.TagIgnorePrereleases {
+		return false
+	}
+	return true
+}
+
+func (f *tagFilter) filter(tags []string) []string {
+	var matched []string
+	for _, tag := range tags {
+		if f.matches(tag) {
+			matched = append(matched, tag)
+		}
+	}
+	return matched
+}
+
+// highestVersion is the highest release among the tags that match the filters. Pre-releases are not considered
+func (f *tagFilter) highestVersion(tags []string) *semver {
+	var highest *semver
+	for _, tag := range tags {
+		v, ok := parseSemver(tag)
+		if !ok || v.isPrerelease() || !f.matches(tag) {
+			continue
+		}
+		if highest == nil || v.compare(highest) > 0 {
+			highest = v
+		}
+	}
+	return highest
+}
+
+// filterTags returns the new tags to be notified with the version bump of each tag
+// compared to the highest version of the tags from the last run
+func filterTags(r *Repo, oldTags, newTags []string) ([]string, map[string]string) {
+	f := newTagFilter(r)
+	previous := f.highestVersion(oldTags)
+	minimum := tagBumpLevels[r.TagMinimumBump]
+
+	var tags []string
+	bumps := make(map[string]string)
+	for _, tag := range newTags {
+		if !f.matches(tag) {
+			continue
+		}
+		v, ok := parseSemver(tag)
+		if !ok {
+			if minimum == 0 {
+				tags = append(tags, tag)
+			}
+			continue
+		}
+		bump := v.bump(previous)
+		if minimum > 0 && bump != "initial" && tagBumpLevels[bump] < minimum {
+			continue
+		}
+		tags = append(tags, tag)
+		if bump != "" {
+			bumps[tag] = bump
+		}
+	}
+	return tags, bumps
+}
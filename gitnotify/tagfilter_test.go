@@ -0,0 +1,94 @@
+package gitnotify
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemverBump(t *testing.T) {
+	previous, _ := parseSemver("v1.4.2")
+	tests := []struct {
+		tag, bump string
+	}{
+		{"v2.0.0", "major"},
+		{"1.5", "minor"},
+		{"v1.4.3", "patch"},
+		{"v1.4.2", ""},
+		{"v1.4.1", ""},
+		{"v1.4.2-rc.1", ""},
+		{"v1.5.0-rc.1", "minor"},
+	}
+	for _, test := range tests {
+		v, ok := parseSemver(test.tag)
+		if !ok {
+			t.Fatalf("%s should parse", test.tag)
+		}
+		if bump := v.bump(previous); bump != test.bump {
+			t.Errorf("%s after %s should be %q, got %q", test.tag, "v1.4.2", test.bump, bump)
+		}
+	}
+	if _, ok := parseSemver("release-2017"); ok {
+		t.Error("release-2017 should not parse")
+	}
+}
+
+func TestComparePrerelease(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0"}
+	for i := 1; i < len(ordered); i++ {
+		a, _ := parseSemver(ordered[i-1])
+		b, _ := parseSemver(ordered[i])
+		if a.compare(b) >= 0 || b.compare(a) <= 0 {
+			t.Errorf("%s should be lower than %s", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func TestFilterTags(t *testing.T) {
+	oldTags := []string{"v1.4.2", "v1.4.1", "v9.0.0-nightly"}
+	newTags := []string{"v1.4.3", "v1.5.0", "v2.0.0-rc.1", "v2.0.0", "nightly-2017", "v3.0.0-nightly"}
+	tests := []struct {
+		repo  Repo
+		tags  []string
+		bumps map[string]string
+	}{
+		{Repo{TagExclude: "nightly"}, []string{"v1.4.3", "v1.5.0", "v2.0.0-rc.1", "v2.0.0"},
+			map[string]string{"v1.4.3": "patch", "v1.5.0": "minor", "v2.0.0-rc.1": "major", "v2.0.0": "major"}},
+		{Repo{TagInclude: `^v\d`, TagIgnorePrereleases: true}, []string{"v1.4.3", "v1.5.0", "v2.0.0"},
+			map[string]string{"v1.4.3": "patch", "v1.5.0": "minor", "v2.0.0": "major"}},
+		{Repo{TagMinimumBump: "minor", TagIgnorePrereleases: true}, []string{"v1.5.0", "v2.0.0"},
+			map[string]string{"v1.5.0": "minor", "v2.0.0": "major"}},
+		{Repo{TagMinimumBump: "major"}, []string{"v2.0.0-rc.1", "v2.0.0", "v3.0.0-nightly"},
+			map[string]string{"v2.0.0-rc.1": "major", "v2.0.0": "major", "v3.0.0-nightly": "major"}},
+	}
+	for _, test := range tests {
+		tags, bumps := filterTags(&test.repo, oldTags, newTags)
+		if !reflect.DeepEqual(tags, test.tags) || !reflect.DeepEqual(bumps, test.bumps) {
+			t.Errorf("%+v should report %v %v, got %v %v", test.repo, test.tags, test.bumps, tags, bumps)
+		}
+	}
+}
+
+func TestProcessRepoDiffTagFilters(t *testing.T) {
+	repo := &Repo{Repo: "acme/widgets", Tags: true, TagMinimumBump: "minor"}
+	remote := &fakeRemote{
+		localGitnull: &localGitnull{GithubProvider},
+		tags:         refs("v1.0.0", "v1.0.1", "v1.1.0"),
+	}
+	info := storedInfo()
+
+	diff, err := processRepoDiff(remote, repo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.RefList) != 1 || !reflect.DeepEqual(diff.RefList[0].References, []string{"v1.1.0"}) {
+		t.Fatalf("expected only the minor bump to be reported, got %v", diff.RefList)
+	}
+	if !reflect.DeepEqual(info["acme/widgets"].Repo.Tags, []string{"v1.0.0", "v1.0.1", "v1.1.0"}) {
+		t.Errorf("filtered tags should still be stored, got %v", info["acme/widgets"].Repo.Tags)
+	}
+
+	datum := makeRepoDiffs([]*gitRepoDiffs{diff}, &Setting{Auth: &Authentication{Provider: GithubProvider}})[0].Data
+	if datum[0].Changes[0].Title != "minor" {
+		t.Errorf("expected the bump in the change title, got %v", datum[0].Changes)
+	}
+}
@@ -23,6 +23,9 @@ type searchRepoItem struct {
 	Name        string `json:"full_name"`
 	Description string `json:"description"`
 	HomePage    string `json:"homepage"`
+	Private     bool   `json:"private"` // set when listing the repositories of an organisation
+	// Path is set when listing the repositories of an organisation that are not under organisation/name
+	Path string `json:"path,omitempty"`
 }
 
 // this file is responsible for handling 2 types of typeaheads
@@ -40,7 +43,7 @@ func repoTypeAheadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if provider == GithubProvider {
-	} else if provider == GitlabProvider {
+	} else if provider == GitlabProvider || provider == GiteaProvider || provider == BitbucketProvider {
 		cacheResponse = false
 	} else {
 		provider = GithubProvider
@@ -65,7 +68,7 @@ func repoTypeAheadHandler(w http.ResponseWriter, r *http.Request) {
 		cacher.SetCachePath("repotypeahead/" + provider + "/" + repoName)
 	}
 
-	result, err := getGitTypeAhead(provider, userInfo.Token, repoName)
+	result, err := getGitTypeAhead(userInfo, repoName)
 	if err != nil {
 		http.NotFound(w, r)
 		return
@@ -94,7 +97,7 @@ func branchTypeAheadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if provider == GithubProvider {
-	} else if provider == GitlabProvider {
+	} else if provider == GitlabProvider || provider == GiteaProvider || provider == BitbucketProvider {
 		cacheResponse = false
 	} else {
 		provider = GithubProvider
@@ -115,13 +118,16 @@ func branchTypeAheadHandler(w http.ResponseWriter, r *http.Request) {
 
 	userInfo := getUserInfo(hc)
 	provider = userInfo.Provider
+	if isPlainGitURL(repoName) {
+		provider = GitProvider
+	}
 	// we are setting again in case provider details in url are different from what was requested
 	// we are okay serving from cache in case they are available with the probably incorrect provider from the request
 	if cacheResponse && setCache {
 		cacher.SetCachePath("branchtypeahead/" + provider + "/" + repoName)
 	}
 
-	tab, err := getGitBranchInfoForRepo(provider, userInfo.Token, repoName)
+	tab, err := getGitBranchInfoForRepo(provider, userInfo, repoName)
 	if err != nil {
 		http.NotFound(w, r)
 		return
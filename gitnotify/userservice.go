@@ -66,6 +66,7 @@ func userSettingsSaveHandler(w http.ResponseWriter, r *http.Request) {
 	userInfo := getUserInfo(hc)
 	configFile := userInfo.getConfigFile()
 
+	defer lockSetting(configFile)()
 	conf := new(Setting)
 	conf.load(configFile)
 
@@ -142,6 +143,8 @@ func userSettingsSaveHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		conf.User.WebhookPrivate = contains(r.Form["webhookPrivate"], "true")
+
 		conf.save(configFile)
 		upsertCronEntry(conf)
 
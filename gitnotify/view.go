@@ -15,6 +15,15 @@ const GithubProvider = "github"
 // GitlabProvider ..
 const GitlabProvider = "gitlab"
 
+// GiteaProvider is used for both Gitea and Forgejo
+const GiteaProvider = "gitea"
+
+// GitProvider is used for repositories tracked by their git url. It does not support login
+const GitProvider = "git"
+
+// BitbucketProvider is Bitbucket Server / Data Center. Bitbucket Cloud is not supported
+const BitbucketProvider = "bitbucket"
+
 // InitView initialises the view
 func InitView() {
 	kinli.CacheMode = config.CacheMode
@@ -72,8 +81,9 @@ func capitalizeOrNone(option string) string {
 	return strings.ToTitle(option)
 }
 
+// cleanRepoName is used as an anchor. repositories can be nested in any number of namespaces
 func cleanRepoName(repo string) string {
-	return strings.Replace(repo, "/", "__", 3)
+	return strings.Replace(repo, "/", "__", -1)
 }
 
 func shortCommit(commit string) string {